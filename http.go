@@ -45,6 +45,7 @@ func HTTP(name, version string, content gohttp.FileSystem, opts ...application.O
 	jsonFlag := flag.CommandLine.Bool("json", false, "Enable JSON logging output")
 	noColorFlag := flag.CommandLine.Bool("no-color", false, "Disable colorized output on text")
 	generateConfig := flag.CommandLine.Bool("generate-config", false, "Generate a default configuration file and exit")
+	routesFormat := flag.CommandLine.String("routes", "", "Print the route table as text or json and exit")
 
 	// parse them
 	if !flag.CommandLine.Parsed() {
@@ -58,11 +59,16 @@ func HTTP(name, version string, content gohttp.FileSystem, opts ...application.O
 	var logHandler slog.Handler
 	logOutput := os.Stdout
 
+	// keep the route table alone on stdout
+	if *routesFormat != "" {
+		logOutput = os.Stderr
+	}
+
 	switch {
 	case *jsonFlag:
-		logHandler = slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: &logLeveler})
+		logHandler = slog.NewJSONHandler(logOutput, &slog.HandlerOptions{Level: &logLeveler})
 	case *noColorFlag:
-		logHandler = slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: &logLeveler})
+		logHandler = slog.NewTextHandler(logOutput, &slog.HandlerOptions{Level: &logLeveler})
 	default:
 		logHandler = tint.NewTextHandler(colorable.NewColorable(logOutput), &tint.Options{
 			Level:   &logLeveler,
@@ -74,7 +80,7 @@ func HTTP(name, version string, content gohttp.FileSystem, opts ...application.O
 		logLeveler.Set(slog.LevelDebug)
 	}
 
-	logger := slog.New(logHandler).With("version", version)
+	logger := slog.New(http.LogHandler(logHandler)).With("version", version)
 
 	bootstrapOpts := []application.Option{
 		application.WithLogger(logger),
@@ -93,9 +99,14 @@ func HTTP(name, version string, content gohttp.FileSystem, opts ...application.O
 		application.WithConfigSources(configSources...),
 		application.WithModule("Telemetry", otel.New()),
 		application.WithModule("NATS", nats.New()),
-		application.WithModule("HTTP", http.New(content)),
 	)
 
+	var httpOpts []http.Option
+	if *routesFormat != "" {
+		httpOpts = append(httpOpts, http.WithRouteTable(os.Stdout, *routesFormat))
+	}
+	bootstrapOpts = append(bootstrapOpts, application.WithModule("HTTP", http.New(content, httpOpts...)))
+
 	// create a new context with the ioc container
 	ctx := ioc.WithContext(context.Background(), &ioc.Container{})
 
@@ -0,0 +1,38 @@
+// Package requestid carries the ID of the request being handled through a
+// context, so the HTTP and NATS modules agree on it without importing each
+// other.
+package requestid
+
+import "context"
+
+// Header is the header the ID is sent in, both on HTTP requests and NATS
+// messages. It's fixed so services and subscribers agree on it without sharing
+// configuration.
+const Header = "X-Request-ID"
+
+type contextKey struct{}
+
+// WithContext returns a copy of ctx carrying id.
+func WithContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the ID carried by ctx, or an empty string.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Valid reports whether id may be accepted from a client: 1 to 128 printable
+// ASCII characters without spaces, so it can't break headers or log lines.
+func Valid(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,142 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/renevo/application"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+type acmeConfig struct {
+	Domains          []string `setting:"domains" description:"The domains to request certificates for, setting any domain enables ACME"`
+	Email            string   `setting:"email" description:"The contact email registered with the ACME account"`
+	DirectoryURL     string   `setting:"directory_url" description:"The ACME directory URL, defaults to Let's Encrypt production"`
+	DirectoryCAFile  string   `setting:"directory_ca_file" description:"File location for an additional CA certificate trusted when connecting to the ACME directory"`
+	CacheDir         string   `setting:"cache_dir" description:"The directory to cache certificates and account keys in"`
+	NATSBucket       string   `setting:"nats_bucket" description:"The NATS key/value bucket to cache certificates and account keys in, used instead of cache_dir"`
+	ChallengeAddress string   `setting:"challenge_address" description:"The address to serve HTTP-01 challenges on, leave empty to only use TLS-ALPN-01"`
+}
+
+// newACMEManager returns an autocert manager for cfg, or nil when no domains
+// are configured. TLS-ALPN-01 challenges are answered by the manager's TLS
+// configuration, HTTP-01 challenges by its HTTPHandler.
+func newACMEManager(cfg acmeConfig, cache autocert.Cache) (*autocert.Manager, error) {
+	if len(cfg.Domains) == 0 {
+		return nil, nil
+	}
+
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      cache,
+		HostPolicy: autocert.HostWhitelist(cfg.Domains...),
+		Email:      cfg.Email,
+	}
+
+	if cfg.DirectoryURL != "" || cfg.DirectoryCAFile != "" {
+		client := &acme.Client{DirectoryURL: cfg.DirectoryURL}
+
+		// test servers such as Pebble serve their directory with a private CA
+		if cfg.DirectoryCAFile != "" {
+			pem, err := os.ReadFile(cfg.DirectoryCAFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read ACME directory CA file: %w", err)
+			}
+
+			pool, err := x509.SystemCertPool()
+			if err != nil {
+				pool = x509.NewCertPool()
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in ACME directory CA file %q", cfg.DirectoryCAFile)
+			}
+
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+			client.HTTPClient = &http.Client{Transport: transport}
+		}
+
+		manager.Client = client
+	}
+
+	return manager, nil
+}
+
+// acmeCache returns the certificate cache selected by cfg. A NATS bucket takes
+// precedence over a cache directory, and nil is returned when neither is set.
+func acmeCache(ctx *application.Context, cfg acmeConfig) (autocert.Cache, error) {
+	switch {
+	case cfg.NATSBucket != "":
+		nc := natsConn(ctx)
+		if nc == nil {
+			return nil, errors.New("ACME NATS cache requires a NATS connection, set nats.address")
+		}
+
+		js, err := jetstream.New(nc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create jetstream context: %w", err)
+		}
+
+		kv, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+			Bucket:      cfg.NATSBucket,
+			Description: "ACME certificate cache",
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create NATS key/value bucket %q: %w", cfg.NATSBucket, err)
+		}
+
+		return natsCache{kv: kv}, nil
+
+	case cfg.CacheDir != "":
+		return autocert.DirCache(cfg.CacheDir), nil
+	}
+
+	return nil, nil
+}
+
+// natsCache implements autocert.Cache with a JetStream key/value bucket so
+// certificates are shared between replicas.
+type natsCache struct {
+	kv jetstream.KeyValue
+}
+
+var _ autocert.Cache = natsCache{}
+
+// natsCacheKey encodes autocert names, which may contain characters such as
+// '+' that are not valid in key/value keys.
+func natsCacheKey(name string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(name))
+}
+
+func (c natsCache) Get(ctx context.Context, name string) ([]byte, error) {
+	entry, err := c.kv.Get(ctx, natsCacheKey(name))
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		return nil, autocert.ErrCacheMiss
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return entry.Value(), nil
+}
+
+func (c natsCache) Put(ctx context.Context, name string, data []byte) error {
+	_, err := c.kv.Put(ctx, natsCacheKey(name), data)
+	return err
+}
+
+func (c natsCache) Delete(ctx context.Context, name string) error {
+	err := c.kv.Delete(ctx, natsCacheKey(name))
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,74 @@
+package http
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func TestNewACMEManagerDisabled(t *testing.T) {
+	manager, err := newACMEManager(acmeConfig{}, nil)
+	if err != nil {
+		t.Fatalf("new ACME manager: %v", err)
+	}
+	if manager != nil {
+		t.Error("manager created without domains")
+	}
+}
+
+func TestNewACMEManager(t *testing.T) {
+	cache := autocert.DirCache(t.TempDir())
+	manager, err := newACMEManager(acmeConfig{
+		Domains:      []string{"example.com"},
+		Email:        "admin@example.com",
+		DirectoryURL: "https://localhost:14000/dir",
+	}, cache)
+	if err != nil {
+		t.Fatalf("new ACME manager: %v", err)
+	}
+
+	if manager.Client == nil || manager.Client.DirectoryURL != "https://localhost:14000/dir" {
+		t.Errorf("directory URL not applied to ACME client")
+	}
+	if manager.Email != "admin@example.com" {
+		t.Errorf("email = %q, want %q", manager.Email, "admin@example.com")
+	}
+	if manager.Cache != cache {
+		t.Error("cache not applied to manager")
+	}
+	if err := manager.HostPolicy(t.Context(), "example.com"); err != nil {
+		t.Errorf("configured domain rejected: %v", err)
+	}
+	if err := manager.HostPolicy(t.Context(), "other.example.com"); err == nil {
+		t.Error("unconfigured domain accepted")
+	}
+	if protos := manager.TLSConfig().NextProtos; !slices.Contains(protos, acme.ALPNProto) {
+		t.Errorf("TLS next protocols %v missing %q", protos, acme.ALPNProto)
+	}
+}
+
+func TestNewACMEManagerDirectoryCAFile(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatalf("write CA file: %v", err)
+	}
+
+	if _, err := newACMEManager(acmeConfig{Domains: []string{"example.com"}, DirectoryCAFile: caFile}, nil); err == nil {
+		t.Error("invalid directory CA file accepted")
+	}
+}
+
+func TestNATSCacheKey(t *testing.T) {
+	for _, name := range []string{"example.com", "example.com+rsa", "acme_account+key"} {
+		key := natsCacheKey(name)
+		for _, r := range key {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+				t.Errorf("key %q for %q contains invalid character %q", key, name, r)
+			}
+		}
+	}
+}
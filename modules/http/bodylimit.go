@@ -0,0 +1,136 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type bodyLimitConfig struct {
+	Route       string `setting:"route" description:"The route template the limit applies to, such as /uploads/{id}"`
+	MaxBodySize int64  `setting:"max_body_size" description:"The maximum request body size in bytes for the route, zero is unlimited"`
+}
+
+// bodyLimits caps request bodies at the route's limit, or the server wide
+// limit for routes without one.
+type bodyLimits struct {
+	limit    int64
+	routes   map[string]int64
+	tooLarge metric.Int64Counter
+}
+
+func newBodyLimits(meter metric.Meter, limit int64, routes []bodyLimitConfig) (*bodyLimits, error) {
+	l := &bodyLimits{limit: limit, routes: make(map[string]int64, len(routes))}
+	for _, route := range routes {
+		if route.Route == "" {
+			return nil, errors.New("body limit needs a route")
+		}
+		if _, exists := l.routes[route.Route]; exists {
+			return nil, fmt.Errorf("route %q is configured more than once", route.Route)
+		}
+		l.routes[route.Route] = route.MaxBodySize
+	}
+
+	var err error
+	l.tooLarge, err = meter.Int64Counter(
+		"http.server.request.body.too_large",
+		metric.WithUnit("{request}"),
+		metric.WithDescription("Number of requests with a body over the size limit"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request body counter: %w", err)
+	}
+
+	return l, nil
+}
+
+// middleware applies the limit once mux has matched a route. Requests that
+// declare a larger Content-Length are rejected before the handler runs, and
+// chunked bodies fail with *http.MaxBytesError when read past the limit.
+func (l *bodyLimits) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body == nil || r.Body == http.NoBody {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var template string
+		limit := l.limit
+		if route := mux.CurrentRoute(r); route != nil {
+			template, _ = route.GetPathTemplate()
+			if h, ok := routeHandler[*maxBodySizeHandler](route); ok {
+				limit = h.limit
+			}
+		}
+		if routeLimit, ok := l.routes[template]; ok {
+			limit = routeLimit
+		}
+
+		if limit <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.ContentLength > limit {
+			l.reject(r.Context(), template, limit)
+			WriteProblem(w, NewProblem(http.StatusRequestEntityTooLarge, fmt.Sprintf("request body is larger than %d bytes", limit)))
+			return
+		}
+
+		r.Body = &limitedBody{
+			ReadCloser: http.MaxBytesReader(w, r.Body, limit),
+			exceeded:   func() { l.reject(r.Context(), template, limit) },
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (l *bodyLimits) reject(ctx context.Context, route string, limit int64) {
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Bool("http.request.body.too_large", true),
+		attribute.Int64("http.request.body.limit", limit),
+	)
+	l.tooLarge.Add(ctx, 1, metric.WithAttributes(attribute.String("http.route", route)))
+}
+
+// MaxBodySize sets the request body size limit of the route handled by next,
+// such as a route streaming large multipart uploads. A limit of zero or less
+// removes it. It must be the route's handler, or wrapped by other route
+// handlers such as Document, and a body_limit setting for the route takes
+// precedence.
+func MaxBodySize(limit int64, next http.Handler) http.Handler {
+	return &maxBodySizeHandler{limit: limit, Handler: next}
+}
+
+type maxBodySizeHandler struct {
+	http.Handler
+	limit int64
+}
+
+func (h *maxBodySizeHandler) Unwrap() http.Handler {
+	return h.Handler
+}
+
+// limitedBody reports the first read past the limit.
+type limitedBody struct {
+	io.ReadCloser
+	exceeded func()
+	reported bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	var maxBytesErr *http.MaxBytesError
+	if !b.reported && errors.As(err, &maxBytesErr) {
+		b.reported = true
+		b.exceeded()
+	}
+	return n, err
+}
@@ -0,0 +1,93 @@
+package http
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+func TestBodyLimits(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	t.Cleanup(func() { _ = provider.Shutdown(t.Context()) })
+
+	limits, err := newBodyLimits(provider.Meter("test"), 10, []bodyLimitConfig{
+		{Route: "/configured", MaxBodySize: 20},
+		{Route: "/configured-upload", MaxBodySize: 5},
+	})
+	if err != nil {
+		t.Fatalf("new body limits: %v", err)
+	}
+
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+		_, _ = w.Write(body)
+	})
+
+	handler, recorder, _ := newTelemetryTestHandler(t, func(router *mux.Router, _ *telemetry) {
+		router.Use(limits.middleware)
+		router.Handle("/default", echo)
+		router.Handle("/configured", echo)
+		router.Handle("/upload", MaxBodySize(30, echo))
+		router.Handle("/unlimited", MaxBodySize(0, echo))
+		router.Handle("/configured-upload", MaxBodySize(30, echo))
+	})
+
+	for _, test := range []struct {
+		path    string
+		size    int
+		chunked bool
+		status  int
+	}{
+		{path: "/default", size: 10, status: http.StatusOK},
+		{path: "/default", size: 11, status: http.StatusRequestEntityTooLarge},
+		{path: "/default", size: 11, chunked: true, status: http.StatusRequestEntityTooLarge},
+		{path: "/configured", size: 20, status: http.StatusOK},
+		{path: "/upload", size: 30, chunked: true, status: http.StatusOK},
+		{path: "/upload", size: 31, status: http.StatusRequestEntityTooLarge},
+		{path: "/unlimited", size: 1000, status: http.StatusOK},
+		{path: "/configured-upload", size: 6, status: http.StatusRequestEntityTooLarge},
+	} {
+		var body io.Reader = strings.NewReader(strings.Repeat("x", test.size))
+		if test.chunked {
+			// hide the length so the body is only limited as it's read
+			body = io.MultiReader(body)
+		}
+		r := httptest.NewRequest(http.MethodPost, test.path, body)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.status {
+			t.Errorf("%s with %d bytes (chunked %t): status = %d, want %d", test.path, test.size, test.chunked, w.Code, test.status)
+		}
+		// declared lengths are rejected before the handler runs
+		if w.Code == http.StatusRequestEntityTooLarge && !test.chunked && w.Header().Get("Content-Type") != "application/problem+json" {
+			t.Errorf("%s with %d bytes: content type = %q, want problem details", test.path, test.size, w.Header().Get("Content-Type"))
+		}
+	}
+
+	if count := int64Sum(t, reader, "http.server.request.body.too_large", "http.route", "/default"); count != 2 {
+		t.Errorf("too large requests for /default = %d, want 2", count)
+	}
+
+	var tooLarge int
+	for _, span := range recorder.Ended() {
+		if value, ok := spanAttribute(span, "http.request.body.too_large"); ok && value.AsBool() {
+			tooLarge++
+		}
+	}
+	if tooLarge != 4 {
+		t.Errorf("spans with http.request.body.too_large = %d, want 4", tooLarge)
+	}
+}
@@ -0,0 +1,215 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// certReloader serves a certificate pair from disk and reloads it when either
+// file changes. A pair that fails to load leaves the previous one in place.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	logger   *slog.Logger
+
+	cert atomic.Pointer[tls.Certificate]
+
+	mu       sync.Mutex
+	certStat fileStamp
+	keyStat  fileStamp
+
+	stop         context.CancelFunc
+	done         chan struct{}
+	registration metric.Registration
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func statFile(name string) (fileStamp, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+// newCertReloader loads the initial certificate pair, failing when it is
+// invalid, and registers the certificate expiry gauge.
+func newCertReloader(certFile, keyFile string, logger *slog.Logger) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, logger: logger}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	meter := otel.Meter("github.com/renevo/bootstrap/modules/http")
+	expiry, err := meter.Float64ObservableGauge(
+		"http.server.tls.certificate.expiry",
+		metric.WithUnit("s"),
+		metric.WithDescription("Time remaining until the serving certificate expires"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate expiry gauge: %w", err)
+	}
+
+	r.registration, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		o.ObserveFloat64(expiry, time.Until(r.notAfter()).Seconds(), metric.WithAttributes(attribute.String("tls.certificate.file", r.certFile)))
+		return nil
+	}, expiry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register certificate expiry gauge: %w", err)
+	}
+
+	return r, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
+
+func (r *certReloader) notAfter() time.Time {
+	if cert := r.cert.Load(); cert != nil && cert.Leaf != nil {
+		return cert.Leaf.NotAfter
+	}
+	return time.Time{}
+}
+
+// reload loads the certificate pair when either file has changed since the
+// last attempt and reports whether a new pair is being served.
+func (r *certReloader) reload() (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	certStat, err := statFile(r.certFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat certificate file: %w", err)
+	}
+	keyStat, err := statFile(r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat certificate key file: %w", err)
+	}
+
+	if r.cert.Load() != nil && certStat == r.certStat && keyStat == r.keyStat {
+		return false, nil
+	}
+
+	// remember the attempt so a broken pair is reported once, writing either
+	// file again triggers another attempt
+	r.certStat, r.keyStat = certStat, keyStat
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to load certificate: %w", err)
+	}
+	if cert.Leaf == nil {
+		return false, errors.New("failed to load certificate: missing leaf certificate")
+	}
+
+	r.cert.Store(&cert)
+
+	return true, nil
+}
+
+// watch polls the certificate files every interval until close is called.
+func (r *certReloader) watch(interval time.Duration) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.stop = cancel
+	r.done = make(chan struct{})
+
+	go func() {
+		defer close(r.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			reloaded, err := r.reload()
+			switch {
+			case err != nil:
+				r.logger.Warn("Failed to reload TLS certificate, keeping the current certificate", "cert_file", r.certFile, "key_file", r.keyFile, "err", err)
+			case reloaded:
+				r.logger.Info("Reloaded TLS certificate", "cert_file", r.certFile, "expires", r.notAfter())
+			}
+		}
+	}()
+}
+
+// expiryWarning returns a health warning when the certificate expires within
+// threshold, or an empty string.
+func (r *certReloader) expiryWarning(threshold time.Duration) string {
+	notAfter := r.notAfter()
+	remaining := time.Until(notAfter)
+	switch {
+	case remaining <= 0:
+		return fmt.Sprintf("TLS certificate %s expired at %s", r.certFile, notAfter.Format(time.RFC3339))
+	case remaining <= threshold:
+		return fmt.Sprintf("TLS certificate %s expires at %s", r.certFile, notAfter.Format(time.RFC3339))
+	}
+	return ""
+}
+
+func (r *certReloader) close() {
+	if r.stop != nil {
+		r.stop()
+		<-r.done
+	}
+	if r.registration != nil {
+		_ = r.registration.Unregister()
+	}
+}
+
+// certificates selects a certificate by the client's SNI host name, falling
+// back to the first when none covers it.
+type certificates []*certReloader
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (c certificates) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	for _, r := range c {
+		if cert := r.cert.Load(); hello.SupportsCertificate(cert) == nil {
+			return cert, nil
+		}
+	}
+	return c[0].GetCertificate(hello)
+}
+
+func (c certificates) watch(interval time.Duration) {
+	for _, r := range c {
+		r.watch(interval)
+	}
+}
+
+func (c certificates) expiryWarnings(threshold time.Duration) []string {
+	var warnings []string
+	for _, r := range c {
+		if warning := r.expiryWarning(threshold); warning != "" {
+			warnings = append(warnings, warning)
+		}
+	}
+	return warnings
+}
+
+func (c certificates) close() {
+	for _, r := range c {
+		r.close()
+	}
+}
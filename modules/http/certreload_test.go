@@ -0,0 +1,159 @@
+package http
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCertReloaderReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeTestCertificate(t, certFile, keyFile, "one", time.Now().Add(time.Hour))
+
+	reloader, err := newCertReloader(certFile, keyFile, slog.Default())
+	if err != nil {
+		t.Fatalf("new certificate reloader: %v", err)
+	}
+	t.Cleanup(reloader.close)
+	assertServedCertificate(t, reloader, "one")
+
+	if reloaded, err := reloader.reload(); err != nil || reloaded {
+		t.Errorf("reload of unchanged files = %t, %v, want false, nil", reloaded, err)
+	}
+
+	writeTestCertificate(t, certFile, keyFile, "two", time.Now().Add(time.Hour))
+	touch(t, certFile, keyFile)
+	if reloaded, err := reloader.reload(); err != nil || !reloaded {
+		t.Fatalf("reload of rotated files = %t, %v, want true, nil", reloaded, err)
+	}
+	assertServedCertificate(t, reloader, "two")
+}
+
+func TestCertReloaderKeepsCertificateOnInvalidPair(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeTestCertificate(t, certFile, keyFile, "one", time.Now().Add(time.Hour))
+
+	reloader, err := newCertReloader(certFile, keyFile, slog.Default())
+	if err != nil {
+		t.Fatalf("new certificate reloader: %v", err)
+	}
+	t.Cleanup(reloader.close)
+
+	// a rotation that has written the certificate but not yet the key
+	otherDir := t.TempDir()
+	writeTestCertificate(t, certFile, filepath.Join(otherDir, "key.pem"), "two", time.Now().Add(time.Hour))
+	touch(t, certFile)
+	if _, err := reloader.reload(); err == nil {
+		t.Fatal("mismatched pair reloaded")
+	}
+	assertServedCertificate(t, reloader, "one")
+
+	// a repeated check does not retry until a file changes
+	if reloaded, err := reloader.reload(); err != nil || reloaded {
+		t.Errorf("reload of unchanged invalid pair = %t, %v, want false, nil", reloaded, err)
+	}
+}
+
+func TestCertReloaderInvalidInitialPair(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, []byte("invalid"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, []byte("invalid"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := newCertReloader(certFile, keyFile, slog.Default()); err == nil {
+		t.Error("invalid initial pair accepted")
+	}
+}
+
+func TestCertReloaderExpiryWarning(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeTestCertificate(t, certFile, keyFile, "one", time.Now().Add(48*time.Hour))
+
+	reloader, err := newCertReloader(certFile, keyFile, slog.Default())
+	if err != nil {
+		t.Fatalf("new certificate reloader: %v", err)
+	}
+	t.Cleanup(reloader.close)
+
+	if warning := reloader.expiryWarning(24 * time.Hour); warning != "" {
+		t.Errorf("unexpected warning %q", warning)
+	}
+	if warning := reloader.expiryWarning(72 * time.Hour); !strings.Contains(warning, "expires") {
+		t.Errorf("warning = %q, want expiry warning", warning)
+	}
+}
+
+func assertServedCertificate(t *testing.T, reloader *certReloader, commonName string) {
+	t.Helper()
+	cert, err := reloader.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("get certificate: %v", err)
+	}
+	if cert.Leaf.Subject.CommonName != commonName {
+		t.Errorf("served certificate %q, want %q", cert.Leaf.Subject.CommonName, commonName)
+	}
+}
+
+// touch moves the modification time of files forward so a rewrite within the
+// file system's timestamp resolution is still detected.
+func touch(t *testing.T, files ...string) {
+	t.Helper()
+	future := time.Now().Add(time.Minute)
+	for _, name := range files {
+		if err := os.Chtimes(name, future, future); err != nil {
+			t.Fatalf("touch %s: %v", name, err)
+		}
+	}
+}
+
+// writeTestCertificate writes a self-signed certificate and its key as PEM.
+func writeTestCertificate(t *testing.T, certFile, keyFile, commonName string, notAfter time.Time) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+}
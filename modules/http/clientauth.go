@@ -0,0 +1,201 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ClientIdentity describes the peer of a request authenticated with a client
+// certificate that was verified against the configured client CA.
+type ClientIdentity struct {
+	// Subject is the distinguished name of the client certificate.
+	Subject string
+	// Issuer is the distinguished name of the client certificate issuer.
+	Issuer string
+	// DNSNames, EmailAddresses and URIs are the certificate's subject
+	// alternative names.
+	DNSNames       []string
+	EmailAddresses []string
+	URIs           []string
+	// SPIFFEID is the first spiffe:// URI SAN, if any.
+	SPIFFEID string
+	// Certificate is the verified client certificate.
+	Certificate *x509.Certificate
+}
+
+// Name returns the most specific identifier for the client, preferring the
+// SPIFFE ID over the subject.
+func (id *ClientIdentity) Name() string {
+	if id.SPIFFEID != "" {
+		return id.SPIFFEID
+	}
+	return id.Subject
+}
+
+type clientIdentityKey struct{}
+
+// ClientIdentityFromContext returns the verified client identity of the
+// request that ctx belongs to.
+func ClientIdentityFromContext(ctx context.Context) (*ClientIdentity, bool) {
+	id, ok := ctx.Value(clientIdentityKey{}).(*ClientIdentity)
+	return id, ok
+}
+
+// RequireClientCertificate rejects requests without a verified client
+// certificate with a 403 Forbidden problem details response.
+func RequireClientCertificate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := ClientIdentityFromContext(r.Context()); !ok {
+			WriteProblem(w, NewProblem(http.StatusForbidden, "client certificate required"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"":        tls.NoClientCert,
+	"none":    tls.NoClientCert,
+	"request": tls.RequestClientCert,
+	"require": tls.RequireAndVerifyClientCert,
+	"verify":  tls.RequireAndVerifyClientCert,
+}
+
+// configureClientAuth applies the client certificate settings to config.
+func configureClientAuth(config *tls.Config, cfg httpConfig) error {
+	authType, ok := clientAuthTypes[strings.ToLower(cfg.ClientAuth)]
+	if !ok {
+		return fmt.Errorf("unknown http.client_auth %q, expected none, request, require or verify", cfg.ClientAuth)
+	}
+
+	if cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA file: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in client CA file %q", cfg.ClientCAFile)
+		}
+		config.ClientCAs = pool
+
+		// certificates offered on request are verified when there is a CA to
+		// verify them against
+		if authType == tls.RequestClientCert {
+			authType = tls.VerifyClientCertIfGiven
+		}
+	} else if authType == tls.RequireAndVerifyClientCert {
+		// without a CA a certificate is never verified into an identity
+		return fmt.Errorf("http.client_auth %q requires http.client_ca_file", cfg.ClientAuth)
+	}
+
+	config.ClientAuth = authType
+
+	return nil
+}
+
+// clientIdentity returns the identity of a verified client certificate on r.
+func clientIdentity(r *http.Request) *ClientIdentity {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	cert := r.TLS.VerifiedChains[0][0]
+	id := &ClientIdentity{
+		Subject:        cert.Subject.String(),
+		Issuer:         cert.Issuer.String(),
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+		Certificate:    cert,
+	}
+	for _, uri := range cert.URIs {
+		id.URIs = append(id.URIs, uri.String())
+		if id.SPIFFEID == "" && strings.EqualFold(uri.Scheme, "spiffe") {
+			id.SPIFFEID = uri.String()
+		}
+	}
+
+	return id
+}
+
+// clientIdentityHandler stores the verified client identity in the request
+// context and as the access log user.
+func clientIdentityHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := clientIdentity(r)
+		if id == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		r = r.WithContext(context.WithValue(r.Context(), clientIdentityKey{}, id))
+
+		// the combined access log reports the URL user as the remote user
+		u := *r.URL
+		u.User = url.User(id.Name())
+		r.URL = &u
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientAuthPaths enforces client certificates for requests under any of the
+// path prefixes. It runs inside the access log and telemetry so rejections are
+// recorded like any other response.
+func clientAuthPaths(prefixes []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		required := RequireClientCertificate(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, prefix := range prefixes {
+				if hasPathPrefix(r.URL.Path, prefix) {
+					required.ServeHTTP(w, r)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// hasPathPrefix reports whether path is prefix or below it, so /admin
+// doesn't match /admin-public.
+func hasPathPrefix(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/")
+}
+
+// clientIdentityAttributes returns span attributes for a verified client.
+func clientIdentityAttributes(id *ClientIdentity) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.String("tls.client.subject", id.Subject),
+		attribute.String("tls.client.issuer", id.Issuer),
+	}
+	if id.SPIFFEID != "" {
+		attrs = append(attrs, attribute.String("tls.client.spiffe_id", id.SPIFFEID))
+	}
+
+	var sans []string
+	sans = append(sans, id.DNSNames...)
+	sans = append(sans, id.EmailAddresses...)
+	sans = append(sans, id.URIs...)
+	if len(sans) > 0 {
+		attrs = append(attrs, attribute.StringSlice("tls.client.san", sans))
+	}
+
+	return attrs
+}
+
+func setClientIdentitySpan(r *http.Request) {
+	if id, ok := ClientIdentityFromContext(r.Context()); ok {
+		trace.SpanFromContext(r.Context()).SetAttributes(clientIdentityAttributes(id)...)
+	}
+}
@@ -0,0 +1,192 @@
+package http
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestClientIdentityHandler(t *testing.T) {
+	cert := newTestClientCertificate(t, "client", "spiffe://example.org/ns/default/sa/billing")
+
+	var got *ClientIdentity
+	var user string
+	handler := clientIdentityHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = ClientIdentityFromContext(r.Context())
+		user = r.URL.User.Username()
+	}))
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	if got == nil {
+		t.Fatal("client identity missing from context")
+	}
+	if got.Subject != "CN=client" {
+		t.Errorf("subject = %q, want %q", got.Subject, "CN=client")
+	}
+	if got.SPIFFEID != "spiffe://example.org/ns/default/sa/billing" {
+		t.Errorf("SPIFFE ID = %q", got.SPIFFEID)
+	}
+	if !slices.Equal(got.DNSNames, []string{"client"}) {
+		t.Errorf("DNS names = %v, want [client]", got.DNSNames)
+	}
+	if user != got.SPIFFEID {
+		t.Errorf("access log user = %q, want %q", user, got.SPIFFEID)
+	}
+}
+
+func TestClientIdentityHandlerUnverified(t *testing.T) {
+	cert := newTestClientCertificate(t, "client", "")
+
+	for _, test := range []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{name: "optional", path: "/public", status: http.StatusNoContent},
+		{name: "required", path: "/internal/users", status: http.StatusForbidden},
+		{name: "required prefix", path: "/admin", status: http.StatusForbidden},
+		{name: "required below prefix", path: "/admin/users", status: http.StatusForbidden},
+		{name: "sibling of prefix", path: "/admin-public", status: http.StatusNoContent},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			handler := clientIdentityHandler(clientAuthPaths([]string{"/internal/", "/admin"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if _, ok := ClientIdentityFromContext(r.Context()); ok {
+					t.Error("unverified certificate produced an identity")
+				}
+				w.WriteHeader(http.StatusNoContent)
+			})))
+
+			// a certificate presented without verification is not trusted
+			request := httptest.NewRequest(http.MethodGet, test.path, nil)
+			request.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+			response := httptest.NewRecorder()
+			handler.ServeHTTP(response, request)
+
+			if response.Code != test.status {
+				t.Errorf("status = %d, want %d", response.Code, test.status)
+			}
+		})
+	}
+}
+
+func TestRequireClientCertificate(t *testing.T) {
+	handler := clientIdentityHandler(RequireClientCertificate(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})))
+
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/", nil))
+	if response.Code != http.StatusForbidden {
+		t.Errorf("status without certificate = %d, want %d", response.Code, http.StatusForbidden)
+	}
+	if response.Header().Get("Content-Type") != "application/problem+json" {
+		t.Errorf("content type = %q, want problem details", response.Header().Get("Content-Type"))
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{newTestClientCertificate(t, "client", "")}}}
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusNoContent {
+		t.Errorf("status with certificate = %d, want %d", response.Code, http.StatusNoContent)
+	}
+}
+
+func TestConfigureClientAuth(t *testing.T) {
+	dir := t.TempDir()
+	caFile, keyFile := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "key.pem")
+	writeTestCertificate(t, caFile, keyFile, "ca", time.Now().Add(time.Hour))
+
+	for _, test := range []struct {
+		mode    string
+		caFile  string
+		want    tls.ClientAuthType
+		wantErr bool
+	}{
+		{mode: "none", want: tls.NoClientCert},
+		{mode: "request", want: tls.RequestClientCert},
+		{mode: "request", caFile: caFile, want: tls.VerifyClientCertIfGiven},
+		{mode: "require", caFile: caFile, want: tls.RequireAndVerifyClientCert},
+		{mode: "require", wantErr: true},
+		{mode: "verify", caFile: caFile, want: tls.RequireAndVerifyClientCert},
+		{mode: "verify", wantErr: true},
+		{mode: "bogus", wantErr: true},
+	} {
+		t.Run(test.mode, func(t *testing.T) {
+			var tlsConfig tls.Config
+			err := configureClientAuth(&tlsConfig, httpConfig{ClientAuth: test.mode, ClientCAFile: test.caFile})
+			if test.wantErr {
+				if err == nil {
+					t.Error("invalid client auth accepted")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("configure client auth: %v", err)
+			}
+			if tlsConfig.ClientAuth != test.want {
+				t.Errorf("client auth = %v, want %v", tlsConfig.ClientAuth, test.want)
+			}
+			if (test.caFile != "") != (tlsConfig.ClientCAs != nil) {
+				t.Errorf("client CAs set = %t, want %t", tlsConfig.ClientCAs != nil, test.caFile != "")
+			}
+		})
+	}
+
+	if err := os.WriteFile(caFile, []byte("invalid"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := configureClientAuth(&tls.Config{}, httpConfig{ClientAuth: "verify", ClientCAFile: caFile}); err == nil {
+		t.Error("invalid client CA file accepted")
+	}
+}
+
+func newTestClientCertificate(t *testing.T, commonName, spiffeID string) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if spiffeID != "" {
+		uri, err := url.Parse(spiffeID)
+		if err != nil {
+			t.Fatalf("parse SPIFFE ID: %v", err)
+		}
+		template.URIs = []*url.URL{uri}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	return cert
+}
@@ -0,0 +1,346 @@
+package http
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+type compressionConfig struct {
+	Enabled                    bool     `setting:"enabled" description:"Compress responses with an encoding the client accepts"`
+	Encodings                  []string `setting:"encodings" description:"The response encodings in order of preference: zstd and gzip"`
+	Level                      string   `setting:"level" description:"The compression level: fastest, default, better or best"`
+	MinSize                    int      `setting:"min_size" description:"The minimum response size in bytes to compress"`
+	ContentTypes               []string `setting:"content_types" description:"The response content types to compress, type/* matches every subtype"`
+	DecompressRequests         bool     `setting:"decompress_requests" description:"Decompress request bodies sent with Content-Encoding: gzip"`
+	MaxDecompressedRequestSize int64    `setting:"max_decompressed_request_size" description:"The maximum size in bytes of a decompressed request body, zero is unlimited"`
+}
+
+var defaultCompressibleTypes = []string{
+	"text/*",
+	"application/json",
+	"application/problem+json",
+	"application/javascript",
+	"application/xml",
+	"application/wasm",
+	"image/svg+xml",
+}
+
+// responseEncoder is a pooled compressor for one content coding.
+type responseEncoder struct {
+	name string
+	pool sync.Pool
+}
+
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// compression negotiates response compression and decompresses gzip request
+// bodies.
+type compression struct {
+	encoders     []*responseEncoder
+	minSize      int
+	contentTypes []string
+	decompress   bool
+	maxBodySize  int64
+}
+
+func newCompression(cfg compressionConfig) (*compression, error) {
+	var gzipLevel int
+	var zstdLevel zstd.EncoderLevel
+	switch cfg.Level {
+	case "fastest":
+		gzipLevel, zstdLevel = gzip.BestSpeed, zstd.SpeedFastest
+	case "", "default":
+		gzipLevel, zstdLevel = gzip.DefaultCompression, zstd.SpeedDefault
+	case "better":
+		gzipLevel, zstdLevel = 7, zstd.SpeedBetterCompression
+	case "best":
+		gzipLevel, zstdLevel = gzip.BestCompression, zstd.SpeedBestCompression
+	default:
+		return nil, fmt.Errorf("unknown level %q", cfg.Level)
+	}
+
+	c := &compression{
+		minSize:      cfg.MinSize,
+		contentTypes: cfg.ContentTypes,
+		decompress:   cfg.DecompressRequests,
+		maxBodySize:  cfg.MaxDecompressedRequestSize,
+	}
+	if len(c.contentTypes) == 0 {
+		c.contentTypes = defaultCompressibleTypes
+	}
+
+	// request decompression works without response compression
+	encodings := cfg.Encodings
+	if !cfg.Enabled {
+		encodings = nil
+	}
+	for _, name := range encodings {
+		e := &responseEncoder{name: strings.ToLower(name)}
+		switch e.name {
+		case "gzip":
+			e.pool.New = func() any {
+				w, _ := gzip.NewWriterLevel(nil, gzipLevel)
+				return w
+			}
+		case "zstd":
+			e.pool.New = func() any {
+				// a single goroutine per response, the server already runs
+				// responses concurrently
+				w, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstdLevel), zstd.WithEncoderConcurrency(1), zstd.WithLowerEncoderMem(true))
+				return w
+			}
+		default:
+			return nil, fmt.Errorf("unknown encoding %q", name)
+		}
+		c.encoders = append(c.encoders, e)
+	}
+
+	return c, nil
+}
+
+func (c *compression) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c.decompress && strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+			body, err := gzip.NewReader(r.Body)
+			if err != nil {
+				WriteProblem(w, NewProblem(http.StatusBadRequest, "invalid gzip request body"))
+				return
+			}
+
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
+			r.Body = &gzipRequestBody{Reader: body, body: r.Body}
+			if c.maxBodySize > 0 {
+				r.Body = http.MaxBytesReader(w, r.Body, c.maxBodySize)
+			}
+		}
+
+		// upgraded connections and HEAD responses have no body to compress
+		if len(c.encoders) == 0 || r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept-Encoding")
+		e := c.negotiate(r.Header.Values("Accept-Encoding"))
+		if e == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, compression: c, encoder: e}
+		defer cw.close()
+
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// negotiate returns the most preferred encoder the client accepts.
+func (c *compression) negotiate(acceptEncoding []string) *responseEncoder {
+	accepted := make(map[string]float64)
+	for _, value := range acceptEncoding {
+		for field := range strings.SplitSeq(value, ",") {
+			name, params, _ := strings.Cut(field, ";")
+			q := 1.0
+			if key, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(key) == "q" {
+				if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					q = parsed
+				}
+			}
+			accepted[strings.ToLower(strings.TrimSpace(name))] = q
+		}
+	}
+
+	for _, e := range c.encoders {
+		q, ok := accepted[e.name]
+		if !ok {
+			q, ok = accepted["*"]
+		}
+		if ok && q > 0 {
+			return e
+		}
+	}
+	return nil
+}
+
+func (c *compression) compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range c.contentTypes {
+		if prefix, ok := strings.CutSuffix(allowed, "/*"); ok {
+			if strings.HasPrefix(mediaType, prefix+"/") {
+				return true
+			}
+		} else if mediaType == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// gzipRequestBody closes both the decompressor and the original body.
+type gzipRequestBody struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func (b *gzipRequestBody) Close() error {
+	_ = b.Reader.Close()
+	return b.body.Close()
+}
+
+// compressWriter buffers the start of a response until it can tell whether
+// the response should be compressed: once min_size bytes are written, on
+// Flush, or when the handler returns.
+type compressWriter struct {
+	http.ResponseWriter
+	compression *compression
+	encoder     *responseEncoder
+
+	status  int
+	buf     []byte
+	decided bool
+	enc     encoder
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	// informational responses are sent straight away
+	if status >= 100 && status < 200 {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	if !w.decided {
+		w.buf = append(w.buf, p...)
+		if len(w.buf) < w.compression.minSize {
+			return len(p), nil
+		}
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	if w.enc != nil {
+		return w.enc.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// decide writes the response headers, compressed when the response allows it
+// and it's large enough or being streamed, followed by the buffered body.
+func (w *compressWriter) decide(compress bool) error {
+	w.decided = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	header := w.Header()
+	if header.Get("Content-Type") == "" && len(w.buf) > 0 {
+		header.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+
+	compress = compress &&
+		w.status != http.StatusNoContent &&
+		w.status != http.StatusNotModified &&
+		w.status != http.StatusPartialContent &&
+		header.Get("Content-Encoding") == "" &&
+		header.Get("Content-Range") == "" &&
+		w.compression.compressible(header.Get("Content-Type"))
+
+	if compress {
+		header.Set("Content-Encoding", w.encoder.name)
+		header.Del("Content-Length")
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+
+		w.enc = w.encoder.pool.Get().(encoder)
+		w.enc.Reset(w.ResponseWriter)
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.enc != nil {
+		_, err = w.enc.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// Flush sends what has been written so far. A streamed response is
+// compressed regardless of min_size, since its final size isn't known.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		_ = w.decide(true)
+	}
+	if w.enc != nil {
+		_ = w.enc.Flush()
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Hijack is only possible before anything has been written.
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if w.decided || len(w.buf) > 0 {
+		return nil, nil, errors.New("http: response already written")
+	}
+	w.decided = true
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *compressWriter) close() {
+	if !w.decided {
+		if w.status == 0 && len(w.buf) == 0 {
+			// the handler wrote nothing, let the server send its default
+			return
+		}
+		// a shorter body than min_size is sent as is
+		_ = w.decide(false)
+	}
+
+	if w.enc != nil {
+		_ = w.enc.Close()
+		w.enc.Reset(nil)
+		w.encoder.pool.Put(w.enc)
+		w.enc = nil
+	}
+}
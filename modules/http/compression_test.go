@@ -0,0 +1,278 @@
+package http
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+func newTestCompression(t *testing.T) *compression {
+	t.Helper()
+
+	c, err := newCompression(compressionConfig{
+		Enabled:                    true,
+		Encodings:                  []string{"zstd", "gzip"},
+		MinSize:                    100,
+		DecompressRequests:         true,
+		MaxDecompressedRequestSize: 1000,
+	})
+	if err != nil {
+		t.Fatalf("new compression: %v", err)
+	}
+	return c
+}
+
+func TestCompressionNegotiate(t *testing.T) {
+	c := newTestCompression(t)
+
+	for accept, want := range map[string]string{
+		"":                      "",
+		"gzip":                  "gzip",
+		"gzip, deflate, br":     "gzip",
+		"gzip, zstd":            "zstd",
+		"zstd;q=0, gzip;q=0.5":  "gzip",
+		"*":                     "zstd",
+		"*;q=0, gzip":           "gzip",
+		"identity":              "",
+		"GZIP;q=1.0, zstd;q=0 ": "gzip",
+	} {
+		var got string
+		if e := c.negotiate([]string{accept}); e != nil {
+			got = e.name
+		}
+		if got != want {
+			t.Errorf("negotiate(%q) = %q, want %q", accept, got, want)
+		}
+	}
+}
+
+func TestCompressionResponse(t *testing.T) {
+	c := newTestCompression(t)
+	large := strings.Repeat(`{"hello":"world"}`, 50)
+
+	for _, test := range []struct {
+		name        string
+		accept      string
+		contentType string
+		body        string
+		want        string
+	}{
+		{name: "zstd", accept: "zstd, gzip", contentType: "application/json", body: large, want: "zstd"},
+		{name: "gzip", accept: "gzip", contentType: "application/json; charset=utf-8", body: large, want: "gzip"},
+		{name: "sniffed", accept: "gzip", body: "<html>" + large, want: "gzip"},
+		{name: "small", accept: "gzip", contentType: "application/json", body: `{}`},
+		{name: "content type", accept: "gzip", contentType: "image/png", body: large},
+		{name: "not accepted", contentType: "application/json", body: large},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			handler := c.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if test.contentType != "" {
+					w.Header().Set("Content-Type", test.contentType)
+				}
+				w.Header().Set("ETag", `"v1"`)
+				w.WriteHeader(http.StatusCreated)
+				// written in pieces so the buffered start is kept
+				_, _ = io.WriteString(w, test.body[:len(test.body)/2])
+				_, _ = io.WriteString(w, test.body[len(test.body)/2:])
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.accept != "" {
+				r.Header.Set("Accept-Encoding", test.accept)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != http.StatusCreated {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusCreated)
+			}
+			if got := w.Header().Get("Content-Encoding"); got != test.want {
+				t.Fatalf("Content-Encoding = %q, want %q", got, test.want)
+			}
+			if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("Vary = %q, want Accept-Encoding", got)
+			}
+			if body := decodeBody(t, test.want, w.Body); body != test.body {
+				t.Errorf("body = %q, want %q", body, test.body)
+			}
+
+			wantETag := `"v1"`
+			if test.want != "" {
+				wantETag = `W/"v1"`
+			}
+			if got := w.Header().Get("ETag"); got != wantETag {
+				t.Errorf("ETag = %q, want %q", got, wantETag)
+			}
+		})
+	}
+}
+
+func TestCompressionFlush(t *testing.T) {
+	c := newTestCompression(t)
+
+	flushed := make(chan struct{})
+	recorder := httptest.NewRecorder()
+	handler := c.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = io.WriteString(w, "first")
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("flush: %v", err)
+		}
+
+		// a short streamed chunk is decodable as soon as it's flushed
+		if !recorder.Flushed {
+			t.Error("response was not flushed")
+		}
+		reader, err := gzip.NewReader(bytes.NewReader(recorder.Body.Bytes()))
+		if err != nil {
+			t.Fatalf("read flushed gzip: %v", err)
+		}
+		chunk := make([]byte, 5)
+		if _, err := io.ReadFull(reader, chunk); err != nil || string(chunk) != "first" {
+			t.Errorf("flushed chunk = %q, %v, want first", chunk, err)
+		}
+		close(flushed)
+
+		_, _ = io.WriteString(w, " second")
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	handler.ServeHTTP(recorder, r)
+	<-flushed
+
+	if body := decodeBody(t, "gzip", recorder.Body); body != "first second" {
+		t.Errorf("body = %q, want %q", body, "first second")
+	}
+}
+
+func TestCompressionStaticFiles(t *testing.T) {
+	c := newTestCompression(t)
+	content := strings.Repeat("body { color: red; }\n", 100)
+	handler := c.handler(http.FileServer(http.FS(fstest.MapFS{"site.css": {Data: []byte(content)}})))
+
+	r := httptest.NewRequest(http.MethodGet, "/site.css", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+	if got := w.Header().Get("Content-Length"); got != "" {
+		t.Errorf("Content-Length = %q on a compressed response", got)
+	}
+	if body := decodeBody(t, "gzip", w.Body); body != content {
+		t.Error("static file body did not round trip")
+	}
+
+	// byte ranges refer to the uncompressed file
+	r.Header.Set("Range", "bytes=0-9")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusPartialContent || w.Header().Get("Content-Encoding") != "" || w.Body.String() != content[:10] {
+		t.Errorf("range response = %d %q %q", w.Code, w.Header().Get("Content-Encoding"), w.Body.String())
+	}
+}
+
+func TestCompressionRequestBody(t *testing.T) {
+	c := newTestCompression(t)
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	_, _ = io.WriteString(gz, "hello")
+	_ = gz.Close()
+
+	var bomb bytes.Buffer
+	gz = gzip.NewWriter(&bomb)
+	_, _ = gz.Write(make([]byte, 1<<20))
+	_ = gz.Close()
+
+	handler := c.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if r.Header.Get("Content-Encoding") != "" {
+			t.Error("Content-Encoding was passed to the handler")
+		}
+		_, _ = w.Write(body)
+	}))
+
+	for _, test := range []struct {
+		name   string
+		body   []byte
+		status int
+		want   string
+	}{
+		{name: "gzip", body: compressed.Bytes(), status: http.StatusOK, want: "hello"},
+		{name: "bomb", body: bomb.Bytes(), status: http.StatusRequestEntityTooLarge},
+		{name: "invalid", body: []byte("not gzip"), status: http.StatusBadRequest},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(test.body))
+			r.Header.Set("Content-Encoding", "gzip")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != test.status {
+				t.Errorf("status = %d, want %d", w.Code, test.status)
+			}
+			if test.status == http.StatusBadRequest && w.Header().Get("Content-Type") != "application/problem+json" {
+				t.Errorf("content type = %q, want problem details", w.Header().Get("Content-Type"))
+			}
+			if test.want != "" && w.Body.String() != test.want {
+				t.Errorf("body = %q, want %q", w.Body.String(), test.want)
+			}
+		})
+	}
+
+	// a zero limit leaves decompressed bodies unlimited
+	c.maxBodySize = 0
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(bomb.Bytes()))
+	r.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Body.Len() != 1<<20 {
+		t.Errorf("unlimited = %d with %d bytes, want 200 with %d", w.Code, w.Body.Len(), 1<<20)
+	}
+}
+
+func decodeBody(t *testing.T, encoding string, body io.Reader) string {
+	t.Helper()
+
+	var reader io.Reader
+	switch encoding {
+	case "":
+		reader = body
+	case "gzip":
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			t.Fatalf("gzip reader: %v", err)
+		}
+		reader = gz
+	case "zstd":
+		zr, err := zstd.NewReader(body)
+		if err != nil {
+			t.Fatalf("zstd reader: %v", err)
+		}
+		defer zr.Close()
+		reader = zr
+	}
+
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("decode %s body: %v", encoding, err)
+	}
+	return string(decoded)
+}
@@ -0,0 +1,161 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// connections limits accepted connections and reports connection metrics.
+type connections struct {
+	maxConns      int
+	maxConnsPerIP int
+
+	mu    sync.Mutex
+	total int
+	perIP map[netip.Addr]int
+
+	// states holds the last state reported by the server for each connection
+	states   sync.Map
+	open     metric.Int64UpDownCounter
+	rejected metric.Int64Counter
+}
+
+func newConnections(meter metric.Meter, maxConns, maxConnsPerIP int) (*connections, error) {
+	open, err := meter.Int64UpDownCounter(
+		"http.server.open_connections",
+		metric.WithUnit("{connection}"),
+		metric.WithDescription("Number of connections by the state reported by the server"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create open connections gauge: %w", err)
+	}
+
+	rejected, err := meter.Int64Counter(
+		"http.server.connection.rejected",
+		metric.WithUnit("{connection}"),
+		metric.WithDescription("Number of connections closed on accept because a connection limit was reached"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rejected connections counter: %w", err)
+	}
+
+	return &connections{
+		maxConns:      maxConns,
+		maxConnsPerIP: maxConnsPerIP,
+		perIP:         make(map[netip.Addr]int),
+		open:          open,
+		rejected:      rejected,
+	}, nil
+}
+
+// trackState implements http.Server.ConnState.
+func (c *connections) trackState(conn net.Conn, state http.ConnState) {
+	ctx := context.Background()
+
+	if previous, ok := c.states.Load(conn); ok {
+		c.open.Add(ctx, -1, connStateAttributes(previous.(http.ConnState)))
+	}
+
+	// hijacked connections are no longer managed by the server
+	if state == http.StateClosed || state == http.StateHijacked {
+		c.states.Delete(conn)
+		return
+	}
+
+	c.states.Store(conn, state)
+	c.open.Add(ctx, 1, connStateAttributes(state))
+}
+
+func connStateAttributes(state http.ConnState) metric.AddOption {
+	return metric.WithAttributes(attribute.String("http.connection.state", state.String()))
+}
+
+// listener wraps ln so connections over the configured limits are closed as
+// soon as they are accepted.
+func (c *connections) listener(ln net.Listener) net.Listener {
+	if c.maxConns <= 0 && c.maxConnsPerIP <= 0 {
+		return ln
+	}
+	return &limitListener{Listener: ln, conns: c}
+}
+
+// acquire reserves a connection slot for addr and returns the reason it was
+// refused, if it was.
+func (c *connections) acquire(addr netip.Addr) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.maxConns > 0 && c.total >= c.maxConns {
+		return "max_connections"
+	}
+	if c.maxConnsPerIP > 0 && addr.IsValid() && c.perIP[addr] >= c.maxConnsPerIP {
+		return "max_connections_per_ip"
+	}
+
+	c.total++
+	if addr.IsValid() {
+		c.perIP[addr]++
+	}
+	return ""
+}
+
+func (c *connections) release(addr netip.Addr) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.total--
+	if !addr.IsValid() {
+		return
+	}
+	if c.perIP[addr]--; c.perIP[addr] <= 0 {
+		delete(c.perIP, addr)
+	}
+}
+
+// limitListener enforces the connection limits. Rejected connections are
+// closed rather than left waiting, so a flood doesn't queue behind the limit.
+type limitListener struct {
+	net.Listener
+	conns *connections
+}
+
+func (ln *limitListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := ln.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		var addr netip.Addr
+		if tcpAddr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+			addr = tcpAddr.AddrPort().Addr().Unmap()
+		}
+
+		if reason := ln.conns.acquire(addr); reason != "" {
+			_ = conn.Close()
+			ln.conns.rejected.Add(context.Background(), 1, metric.WithAttributes(attribute.String("reason", reason)))
+			continue
+		}
+
+		return &limitConn{Conn: conn, release: func() { ln.conns.release(addr) }}, nil
+	}
+}
+
+type limitConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
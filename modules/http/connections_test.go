@@ -0,0 +1,156 @@
+package http
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestLimitListener(t *testing.T) {
+	for _, test := range []struct {
+		name          string
+		maxConns      int
+		maxConnsPerIP int
+		reason        string
+	}{
+		{name: "max connections", maxConns: 2, reason: "max_connections"},
+		{name: "max connections per ip", maxConnsPerIP: 2, reason: "max_connections_per_ip"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			conns, reader := newTestConnections(t, test.maxConns, test.maxConnsPerIP)
+
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("listen: %v", err)
+			}
+			limited := conns.listener(listener)
+			t.Cleanup(func() { _ = limited.Close() })
+
+			accepted := make(chan net.Conn, 3)
+			go func() {
+				for {
+					conn, err := limited.Accept()
+					if err != nil {
+						return
+					}
+					accepted <- conn
+				}
+			}()
+
+			for range 3 {
+				conn, err := net.Dial("tcp", listener.Addr().String())
+				if err != nil {
+					t.Fatalf("dial: %v", err)
+				}
+				t.Cleanup(func() { _ = conn.Close() })
+			}
+
+			first, second := <-accepted, <-accepted
+			assertNoAccept(t, accepted)
+			if count := int64Sum(t, reader, "http.server.connection.rejected", "reason", test.reason); count != 1 {
+				t.Errorf("rejected connections = %d, want 1", count)
+			}
+
+			// closing an accepted connection frees its slot
+			_ = first.Close()
+			_ = first.Close()
+			conn, err := net.Dial("tcp", listener.Addr().String())
+			if err != nil {
+				t.Fatalf("dial: %v", err)
+			}
+			t.Cleanup(func() { _ = conn.Close() })
+
+			select {
+			case third := <-accepted:
+				_ = third.Close()
+			case <-time.After(5 * time.Second):
+				t.Fatal("connection was not accepted after a slot was released")
+			}
+			_ = second.Close()
+		})
+	}
+}
+
+func TestConnectionStateMetrics(t *testing.T) {
+	conns, reader := newTestConnections(t, 0, 0)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if count := int64Sum(t, reader, "http.server.open_connections", "http.connection.state", "active"); count != 1 {
+			t.Errorf("active connections = %d, want 1", count)
+		}
+	}))
+	server.Config.ConnState = conns.trackState
+	server.Start()
+
+	response, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	_ = response.Body.Close()
+
+	server.Close()
+	for _, state := range []string{"new", "active", "idle"} {
+		if count := int64Sum(t, reader, "http.server.open_connections", "http.connection.state", state); count != 0 {
+			t.Errorf("%s connections after close = %d, want 0", state, count)
+		}
+	}
+}
+
+func newTestConnections(t *testing.T, maxConns, maxConnsPerIP int) (*connections, *sdkmetric.ManualReader) {
+	t.Helper()
+
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	t.Cleanup(func() { _ = provider.Shutdown(t.Context()) })
+
+	conns, err := newConnections(provider.Meter("test"), maxConns, maxConnsPerIP)
+	if err != nil {
+		t.Fatalf("new connections: %v", err)
+	}
+	return conns, reader
+}
+
+func assertNoAccept(t *testing.T, accepted <-chan net.Conn) {
+	t.Helper()
+
+	select {
+	case conn := <-accepted:
+		_ = conn.Close()
+		t.Fatal("connection over the limit was accepted")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// int64Sum returns the value of an int64 sum metric for the data point with
+// the given attribute.
+func int64Sum(t *testing.T, reader *sdkmetric.ManualReader, name, key, value string) int64 {
+	t.Helper()
+
+	var metrics metricdata.ResourceMetrics
+	if err := reader.Collect(t.Context(), &metrics); err != nil {
+		t.Fatalf("collect metrics: %v", err)
+	}
+	for _, scope := range metrics.ScopeMetrics {
+		for _, metric := range scope.Metrics {
+			if metric.Name != name {
+				continue
+			}
+			sum, ok := metric.Data.(metricdata.Sum[int64])
+			if !ok {
+				t.Fatalf("%s has type %T, want int64 sum", name, metric.Data)
+			}
+			for _, point := range sum.DataPoints {
+				if attr, ok := point.Attributes.Value(attribute.Key(key)); ok && attr.AsString() == value {
+					return point.Value
+				}
+			}
+		}
+	}
+	return 0
+}
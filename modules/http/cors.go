@@ -0,0 +1,261 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type corsConfig struct {
+	Enabled          bool             `setting:"enabled" description:"Answer CORS preflight requests and add CORS headers before routing"`
+	AllowedOrigins   []string         `setting:"allowed_origins" description:"The allowed origins: exact, * for any, wildcards such as https://*.example.com, or regular expressions between slashes"`
+	AllowedMethods   []string         `setting:"allowed_methods" description:"The methods allowed in cross-origin requests"`
+	AllowedHeaders   []string         `setting:"allowed_headers" description:"The request headers allowed in cross-origin requests, * allows any"`
+	ExposedHeaders   []string         `setting:"exposed_headers" description:"The response headers readable by cross-origin scripts"`
+	AllowCredentials bool             `setting:"allow_credentials" description:"Allow cookies and authorization in cross-origin requests"`
+	MaxAge           time.Duration    `setting:"max_age" description:"How long browsers may cache preflight responses"`
+	Paths            []corsPathConfig `config:"path,block"`
+}
+
+// corsPathConfig replaces the default policy for requests under a prefix.
+type corsPathConfig struct {
+	Prefix           string        `setting:"prefix" description:"The path prefix the policy applies to, matching whole path segments, the longest matching prefix wins"`
+	AllowedOrigins   []string      `setting:"allowed_origins" description:"The allowed origins: exact, * for any, wildcards such as https://*.example.com, or regular expressions between slashes"`
+	AllowedMethods   []string      `setting:"allowed_methods" description:"The methods allowed in cross-origin requests"`
+	AllowedHeaders   []string      `setting:"allowed_headers" description:"The request headers allowed in cross-origin requests, * allows any"`
+	ExposedHeaders   []string      `setting:"exposed_headers" description:"The response headers readable by cross-origin scripts"`
+	AllowCredentials bool          `setting:"allow_credentials" description:"Allow cookies and authorization in cross-origin requests"`
+	MaxAge           time.Duration `setting:"max_age" description:"How long browsers may cache preflight responses"`
+}
+
+var (
+	defaultCORSMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	defaultCORSHeaders = []string{"Accept", "Accept-Language", "Content-Language", "Content-Type"}
+)
+
+type corsPolicy struct {
+	prefix           string
+	anyOrigin        bool
+	origins          map[string]struct{}
+	originPatterns   []*regexp.Regexp
+	methods          []string
+	anyHeader        bool
+	headers          map[string]struct{}
+	allowedHeaders   string
+	exposedHeaders   string
+	allowCredentials bool
+	maxAge           time.Duration
+}
+
+// cors applies the policy for the longest matching path prefix, falling back
+// to the default policy.
+type cors struct {
+	policy *corsPolicy
+	paths  []*corsPolicy
+}
+
+func newCORS(cfg corsConfig) (*cors, error) {
+	policy, err := newCORSPolicy(corsPathConfig{
+		AllowedOrigins:   cfg.AllowedOrigins,
+		AllowedMethods:   cfg.AllowedMethods,
+		AllowedHeaders:   cfg.AllowedHeaders,
+		ExposedHeaders:   cfg.ExposedHeaders,
+		AllowCredentials: cfg.AllowCredentials,
+		MaxAge:           cfg.MaxAge,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c := &cors{policy: policy}
+	for _, path := range cfg.Paths {
+		if path.Prefix == "" {
+			return nil, errors.New("path policy needs a prefix")
+		}
+		policy, err := newCORSPolicy(path)
+		if err != nil {
+			return nil, fmt.Errorf("path %q: %w", path.Prefix, err)
+		}
+		c.paths = append(c.paths, policy)
+	}
+
+	// longest prefixes first, so the first match is the most specific
+	slices.SortStableFunc(c.paths, func(a, b *corsPolicy) int {
+		return len(b.prefix) - len(a.prefix)
+	})
+
+	return c, nil
+}
+
+func newCORSPolicy(cfg corsPathConfig) (*corsPolicy, error) {
+	p := &corsPolicy{
+		prefix:           cfg.Prefix,
+		origins:          make(map[string]struct{}),
+		headers:          make(map[string]struct{}),
+		exposedHeaders:   strings.Join(cfg.ExposedHeaders, ", "),
+		allowCredentials: cfg.AllowCredentials,
+		maxAge:           cfg.MaxAge,
+	}
+
+	for _, origin := range cfg.AllowedOrigins {
+		switch {
+		case origin == "*":
+			p.anyOrigin = true
+		case len(origin) > 1 && strings.HasPrefix(origin, "/") && strings.HasSuffix(origin, "/"):
+			// patterns match the whole origin, like the wildcards
+			pattern, err := regexp.Compile("^(?:" + origin[1:len(origin)-1] + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("invalid origin pattern %q: %w", origin, err)
+			}
+			p.originPatterns = append(p.originPatterns, pattern)
+		case strings.Contains(origin, "*"):
+			parts := strings.Split(strings.ToLower(origin), "*")
+			for i, part := range parts {
+				parts[i] = regexp.QuoteMeta(part)
+			}
+			p.originPatterns = append(p.originPatterns, regexp.MustCompile("^"+strings.Join(parts, "[^/]*")+"$"))
+		default:
+			p.origins[strings.ToLower(origin)] = struct{}{}
+		}
+	}
+
+	// browsers don't send credentials to *, and reflecting every origin
+	// instead would let any site make credentialed requests
+	if p.anyOrigin && p.allowCredentials {
+		return nil, errors.New("allowed origin * cannot be used with allow_credentials")
+	}
+
+	p.methods = defaultCORSMethods
+	if len(cfg.AllowedMethods) > 0 {
+		p.methods = make([]string, len(cfg.AllowedMethods))
+		for i, method := range cfg.AllowedMethods {
+			p.methods[i] = strings.ToUpper(method)
+		}
+	}
+
+	headers := cfg.AllowedHeaders
+	if len(headers) == 0 {
+		headers = defaultCORSHeaders
+	}
+	for _, header := range headers {
+		if header == "*" {
+			p.anyHeader = true
+			continue
+		}
+		p.headers[http.CanonicalHeaderKey(header)] = struct{}{}
+	}
+	p.allowedHeaders = strings.Join(headers, ", ")
+
+	return p, nil
+}
+
+func (p *corsPolicy) allowsOrigin(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if _, ok := p.origins[origin]; ok {
+		return true
+	}
+	for _, pattern := range p.originPatterns {
+		if pattern.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *corsPolicy) allowsHeaders(requested string) bool {
+	if p.anyHeader {
+		return true
+	}
+	for header := range strings.SplitSeq(requested, ",") {
+		if header = strings.TrimSpace(header); header == "" {
+			continue
+		}
+		if _, ok := p.headers[http.CanonicalHeaderKey(header)]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *cors) policyFor(path string) *corsPolicy {
+	for _, policy := range c.paths {
+		if hasPathPrefix(path, policy.prefix) {
+			return policy
+		}
+	}
+	return c.policy
+}
+
+// handler answers preflight requests itself, so they never reach the router
+// and its 405 handling, and adds CORS headers to allowed cross-origin
+// requests.
+func (c *cors) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		policy := c.policyFor(r.URL.Path)
+		header := w.Header()
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		if preflight {
+			header.Add("Vary", "Origin, Access-Control-Request-Method, Access-Control-Request-Headers")
+
+			method := r.Header.Get("Access-Control-Request-Method")
+			requested := r.Header.Get("Access-Control-Request-Headers")
+			if policy.allowsOrigin(origin) && slices.Contains(policy.methods, method) && policy.allowsHeaders(requested) {
+				policy.setOrigin(header, origin)
+				header.Set("Access-Control-Allow-Methods", strings.Join(policy.methods, ", "))
+				if policy.anyHeader {
+					// a literal * is not honoured for credentialed requests
+					if requested != "" {
+						header.Set("Access-Control-Allow-Headers", requested)
+					}
+				} else if policy.allowedHeaders != "" {
+					header.Set("Access-Control-Allow-Headers", policy.allowedHeaders)
+				}
+				if policy.maxAge > 0 {
+					header.Set("Access-Control-Max-Age", strconv.Itoa(int(policy.maxAge.Seconds())))
+				}
+			}
+
+			// denied preflights get no CORS headers, which the browser
+			// reports to the calling script
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		header.Add("Vary", "Origin")
+		if policy.allowsOrigin(origin) {
+			policy.setOrigin(header, origin)
+			if policy.exposedHeaders != "" {
+				header.Set("Access-Control-Expose-Headers", policy.exposedHeaders)
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (p *corsPolicy) setOrigin(header http.Header, origin string) {
+	if p.anyOrigin {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		// credentialed responses must name the origin
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+	if p.allowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
@@ -0,0 +1,164 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestCORSPreflight(t *testing.T) {
+	c, err := newCORS(corsConfig{
+		AllowedOrigins:   []string{"https://app.example.com", "https://*.preview.example.com", `/^https://pr-\d+\.example\.dev$/`},
+		AllowedMethods:   []string{"get", "put"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("new cors: %v", err)
+	}
+
+	// the router only allows GET, so preflight would otherwise be a 405
+	router := mux.NewRouter()
+	router.HandleFunc("/users/{id}", func(http.ResponseWriter, *http.Request) {}).Methods(http.MethodGet, http.MethodPut)
+	handler := c.handler(router)
+
+	for _, test := range []struct {
+		name    string
+		origin  string
+		method  string
+		headers string
+		allowed bool
+	}{
+		{name: "exact origin", origin: "https://app.example.com", method: http.MethodPut, headers: "content-type, authorization", allowed: true},
+		{name: "wildcard origin", origin: "https://feature.preview.example.com", method: http.MethodGet, allowed: true},
+		{name: "regex origin", origin: "https://pr-42.example.dev", method: http.MethodGet, allowed: true},
+		{name: "unknown origin", origin: "https://evil.example.net", method: http.MethodGet},
+		{name: "wildcard does not cross hosts", origin: "https://evil.net/.preview.example.com", method: http.MethodGet},
+		{name: "method", origin: "https://app.example.com", method: http.MethodDelete},
+		{name: "header", origin: "https://app.example.com", method: http.MethodGet, headers: "X-Custom"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodOptions, "/users/1", nil)
+			r.Header.Set("Origin", test.origin)
+			r.Header.Set("Access-Control-Request-Method", test.method)
+			if test.headers != "" {
+				r.Header.Set("Access-Control-Request-Headers", test.headers)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != http.StatusNoContent {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusNoContent)
+			}
+
+			allowOrigin := w.Header().Get("Access-Control-Allow-Origin")
+			if !test.allowed {
+				if allowOrigin != "" {
+					t.Errorf("denied preflight has Access-Control-Allow-Origin %q", allowOrigin)
+				}
+				return
+			}
+
+			if allowOrigin != test.origin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", allowOrigin, test.origin)
+			}
+			for header, want := range map[string]string{
+				"Access-Control-Allow-Methods":     "GET, PUT",
+				"Access-Control-Allow-Headers":     "Content-Type, Authorization",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Max-Age":           "600",
+			} {
+				if got := w.Header().Get(header); got != want {
+					t.Errorf("%s = %q, want %q", header, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCORSRequest(t *testing.T) {
+	c, err := newCORS(corsConfig{
+		AllowedOrigins: []string{"*"},
+		ExposedHeaders: []string{"X-Request-Id"},
+		Paths: []corsPathConfig{
+			{Prefix: "/api/", AllowedOrigins: []string{"https://app.example.com"}},
+			{Prefix: "/api/private/"},
+			{Prefix: "/admin"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("new cors: %v", err)
+	}
+
+	handler := c.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, test := range []struct {
+		path   string
+		origin string
+		want   string
+	}{
+		{path: "/", origin: "https://any.example.net", want: "*"},
+		{path: "/api/users", origin: "https://app.example.com", want: "https://app.example.com"},
+		{path: "/api/users", origin: "https://any.example.net"},
+		{path: "/api/private/keys", origin: "https://app.example.com"},
+		{path: "/admin/users", origin: "https://any.example.net"},
+		{path: "/administrator", origin: "https://any.example.net", want: "*"},
+		{path: "/admin-public", origin: "https://any.example.net", want: "*"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, test.path, nil)
+		r.Header.Set("Origin", test.origin)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != test.want {
+			t.Errorf("%s from %s: Access-Control-Allow-Origin = %q, want %q", test.path, test.origin, got, test.want)
+		}
+		if got := w.Header().Get("Vary"); got != "Origin" {
+			t.Errorf("%s: Vary = %q, want Origin", test.path, got)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Origin", "https://any.example.net")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if got := w.Header().Get("Access-Control-Expose-Headers"); got != "X-Request-Id" {
+		t.Errorf("Access-Control-Expose-Headers = %q, want X-Request-Id", got)
+	}
+}
+
+func TestNewCORSInvalid(t *testing.T) {
+	if _, err := newCORS(corsConfig{AllowedOrigins: []string{"/[/"}}); err == nil {
+		t.Error("invalid origin pattern was accepted")
+	}
+	if _, err := newCORS(corsConfig{Paths: []corsPathConfig{{}}}); err == nil {
+		t.Error("path policy without a prefix was accepted")
+	}
+	if _, err := newCORS(corsConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true}); err == nil {
+		t.Error("any origin with credentials was accepted")
+	}
+	if _, err := newCORS(corsConfig{Paths: []corsPathConfig{{Prefix: "/api/", AllowedOrigins: []string{"*"}, AllowCredentials: true}}}); err == nil {
+		t.Error("path policy allowing any origin with credentials was accepted")
+	}
+}
+
+func TestCORSOriginPatternAnchored(t *testing.T) {
+	c, err := newCORS(corsConfig{AllowedOrigins: []string{`/https://app\.example\.com/`}})
+	if err != nil {
+		t.Fatalf("new cors: %v", err)
+	}
+
+	for origin, want := range map[string]bool{
+		"https://app.example.com":                  true,
+		"https://app.example.com.evil.net":         false,
+		"https://evil.net/https://app.example.com": false,
+	} {
+		if got := c.policy.allowsOrigin(origin); got != want {
+			t.Errorf("allowsOrigin(%q) = %t, want %t", origin, got, want)
+		}
+	}
+}
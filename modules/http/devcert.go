@@ -0,0 +1,169 @@
+package http
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+type devTLSConfig struct {
+	Enabled  bool     `setting:"enabled" description:"Serve HTTPS with a generated development certificate, never enable this in production"`
+	Hosts    []string `setting:"hosts" description:"Additional host names and IP addresses for the development certificate, localhost is always included"`
+	CacheDir string   `setting:"cache_dir" description:"The directory to keep the development CA and certificate in, defaults to the user cache directory"`
+}
+
+const (
+	devCAValidity   = 10 * 365 * 24 * time.Hour
+	devLeafValidity = 365 * 24 * time.Hour
+	devLeafRenewal  = 30 * 24 * time.Hour
+)
+
+// devHosts are always covered by the development certificate.
+var devHosts = []string{"localhost", "127.0.0.1", "::1"}
+
+// devCertificate holds the files of a generated development certificate.
+type devCertificate struct {
+	CAFile   string
+	CertFile string
+	KeyFile  string
+}
+
+// ensureDevCertificate loads the development CA from dir, creating it when it
+// does not exist, and issues a leaf certificate for hosts when the cached one
+// is missing, close to expiry, issued by another CA or for other hosts.
+func ensureDevCertificate(dir, name string, hosts []string) (devCertificate, error) {
+	files := devCertificate{
+		CAFile:   filepath.Join(dir, "ca.pem"),
+		CertFile: filepath.Join(dir, "cert.pem"),
+		KeyFile:  filepath.Join(dir, "key.pem"),
+	}
+	caKeyFile := filepath.Join(dir, "ca-key.pem")
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return files, fmt.Errorf("failed to create development certificate directory: %w", err)
+	}
+
+	hosts = slices.Compact(slices.Sorted(slices.Values(append(slices.Clone(devHosts), hosts...))))
+
+	ca, err := tls.LoadX509KeyPair(files.CAFile, caKeyFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		ca, err = createDevCA(files.CAFile, caKeyFile, name)
+	}
+	if err != nil {
+		return files, fmt.Errorf("failed to load development CA: %w", err)
+	}
+
+	if leaf, err := tls.LoadX509KeyPair(files.CertFile, files.KeyFile); err == nil && devLeafValid(leaf.Leaf, ca.Leaf, hosts) {
+		return files, nil
+	}
+
+	if err := createDevLeaf(files.CertFile, files.KeyFile, ca, hosts); err != nil {
+		return files, fmt.Errorf("failed to create development certificate: %w", err)
+	}
+
+	return files, nil
+}
+
+func devLeafValid(leaf, ca *x509.Certificate, hosts []string) bool {
+	if time.Until(leaf.NotAfter) < devLeafRenewal || leaf.CheckSignatureFrom(ca) != nil {
+		return false
+	}
+
+	for _, host := range hosts {
+		if leaf.VerifyHostname(host) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func createDevCA(certFile, keyFile, name string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: name + " Development CA", Organization: []string{"Development"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(devCAValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	if err := writeDevCertificate(certFile, keyFile, template, template, key, key); err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.LoadX509KeyPair(certFile, keyFile)
+}
+
+func createDevLeaf(certFile, keyFile string, ca tls.Certificate, hosts []string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: devHosts[0], Organization: []string{"Development"}},
+		NotBefore:   time.Now().Add(-time.Hour),
+		NotAfter:    time.Now().Add(devLeafValidity),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	signer, ok := ca.PrivateKey.(crypto.Signer)
+	if !ok {
+		return errors.New("development CA key cannot sign certificates")
+	}
+
+	return writeDevCertificate(certFile, keyFile, template, ca.Leaf, key, signer)
+}
+
+// writeDevCertificate issues template for key, signed by signer as parent, and
+// writes the certificate and key as PEM files.
+func writeDevCertificate(certFile, keyFile string, template, parent *x509.Certificate, key *ecdsa.PrivateKey, signer crypto.Signer) error {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+	template.SerialNumber = serial
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		return err
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		return err
+	}
+	return os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644)
+}
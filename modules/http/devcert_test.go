@@ -0,0 +1,60 @@
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"testing"
+)
+
+func TestEnsureDevCertificate(t *testing.T) {
+	dir := t.TempDir()
+
+	files, err := ensureDevCertificate(dir, "example", []string{"app.test", "10.0.0.1"})
+	if err != nil {
+		t.Fatalf("ensure development certificate: %v", err)
+	}
+
+	leaf := loadTestLeaf(t, files)
+	roots := x509.NewCertPool()
+	caPEM, err := os.ReadFile(files.CAFile)
+	if err != nil {
+		t.Fatalf("read CA: %v", err)
+	}
+	roots.AppendCertsFromPEM(caPEM)
+
+	for _, host := range []string{"localhost", "127.0.0.1", "::1", "app.test", "10.0.0.1"} {
+		if _, err := leaf.Verify(x509.VerifyOptions{Roots: roots, DNSName: host}); err != nil {
+			t.Errorf("certificate not valid for %s: %v", host, err)
+		}
+	}
+
+	// an unchanged configuration reuses the cached certificate
+	if _, err := ensureDevCertificate(dir, "example", []string{"10.0.0.1", "app.test"}); err != nil {
+		t.Fatalf("ensure cached development certificate: %v", err)
+	}
+	if cached := loadTestLeaf(t, files); cached.SerialNumber.Cmp(leaf.SerialNumber) != 0 {
+		t.Error("cached certificate was reissued")
+	}
+
+	// a new host reissues the certificate from the same CA
+	if _, err := ensureDevCertificate(dir, "example", []string{"other.test"}); err != nil {
+		t.Fatalf("ensure reissued development certificate: %v", err)
+	}
+	reissued := loadTestLeaf(t, files)
+	if reissued.SerialNumber.Cmp(leaf.SerialNumber) == 0 {
+		t.Error("certificate not reissued for new host")
+	}
+	if _, err := reissued.Verify(x509.VerifyOptions{Roots: roots, DNSName: "other.test"}); err != nil {
+		t.Errorf("reissued certificate not valid for the cached CA: %v", err)
+	}
+}
+
+func loadTestLeaf(t *testing.T, files devCertificate) *x509.Certificate {
+	t.Helper()
+	cert, err := tls.LoadX509KeyPair(files.CertFile, files.KeyFile)
+	if err != nil {
+		t.Fatalf("load development certificate: %v", err)
+	}
+	return cert.Leaf
+}
@@ -0,0 +1,223 @@
+package http
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+type errorPagesConfig struct {
+	Templates string `setting:"templates" description:"The content directory of HTML error page templates named by status, such as 404.html, with error.html for any status"`
+}
+
+// errorPage is the data error page templates are executed with.
+type errorPage struct {
+	Status    int
+	Title     string
+	Detail    string
+	Method    string
+	Path      string
+	Allow     []string
+	RequestID string
+	Nonce     string
+}
+
+// errorPages responds to errors with problem details for API clients, and
+// with HTML templates for browsers.
+type errorPages struct {
+	templates map[int]*template.Template
+	fallback  *template.Template
+}
+
+func newErrorPages(content http.FileSystem, dir string) (*errorPages, error) {
+	p := &errorPages{templates: make(map[int]*template.Template)}
+	if content == nil || dir == "" {
+		return p, nil
+	}
+
+	for _, status := range []int{http.StatusNotFound, http.StatusMethodNotAllowed} {
+		tmpl, err := loadErrorTemplate(content, path.Join("/", dir, strconv.Itoa(status)+".html"))
+		if err != nil {
+			return nil, err
+		}
+		if tmpl != nil {
+			p.templates[status] = tmpl
+		}
+	}
+
+	var err error
+	p.fallback, err = loadErrorTemplate(content, path.Join("/", dir, "error.html"))
+	return p, err
+}
+
+// loadErrorTemplate parses the template at name, or returns nil when there's
+// none.
+func loadErrorTemplate(content http.FileSystem, name string) (*template.Template, error) {
+	f, err := content.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open error page %q: %w", name, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	source, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read error page %q: %w", name, err)
+	}
+
+	tmpl, err := template.New(path.Base(name)).Parse(string(source))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse error page %q: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// handler responds to every request with status.
+func (p *errorPages) handler(status int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.respond(w, r, status)
+	})
+}
+
+// respond writes the response for status in the format the client prefers:
+// problem details, an HTML page when there's a template for it, or text.
+func (p *errorPages) respond(w http.ResponseWriter, r *http.Request, status int) {
+	page := errorPage{
+		Status:    status,
+		Title:     http.StatusText(status),
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		RequestID: RequestIDFromContext(r.Context()),
+		Nonce:     CSPNonceFromContext(r.Context()),
+	}
+	if allow := w.Header().Get("Allow"); allow != "" {
+		page.Allow = strings.Split(allow, ", ")
+		page.Detail = fmt.Sprintf("%s is not allowed, the allowed methods are %s", r.Method, allow)
+	}
+
+	switch negotiateContentType(r.Header.Values("Accept"), "application/problem+json", "application/json", "text/html", "text/plain") {
+	case "text/html":
+		tmpl := p.templates[status]
+		if tmpl == nil {
+			tmpl = p.fallback
+		}
+		if tmpl == nil {
+			break
+		}
+
+		var body bytes.Buffer
+		if err := tmpl.Execute(&body, page); err != nil {
+			break
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		_, _ = body.WriteTo(w)
+		return
+	case "text/plain":
+	default:
+		WriteProblem(w, &Problem{Title: page.Title, Status: status, Detail: page.Detail, Instance: r.URL.Path})
+		return
+	}
+
+	text := strings.ToLower(page.Title)
+	if status == http.StatusNotFound {
+		// matches the response of http.NotFound
+		text = "404 page not found"
+	}
+	http.Error(w, text, status)
+}
+
+// fileServer serves content, with the error page for missing files.
+func (p *errorPages) fileServer(content http.FileSystem) http.Handler {
+	files := http.FileServer(content)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nw := &notFoundWriter{ResponseWriter: w}
+		files.ServeHTTP(nw, r)
+		if nw.notFound {
+			p.respond(w, r, http.StatusNotFound)
+		}
+	})
+}
+
+// notFoundWriter discards a not found response, so it can be replaced.
+type notFoundWriter struct {
+	http.ResponseWriter
+	notFound bool
+}
+
+func (w *notFoundWriter) WriteHeader(status int) {
+	if status == http.StatusNotFound {
+		w.notFound = true
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *notFoundWriter) Write(p []byte) (int, error) {
+	if w.notFound {
+		return len(p), nil
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *notFoundWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// negotiateContentType returns the offer the Accept header values prefer,
+// the first one on a tie or without an Accept header. Each offer takes the
+// quality of the most specific media range matching it.
+func negotiateContentType(accept []string, offers ...string) string {
+	best, bestQ := offers[0], 0.0
+	if len(accept) == 0 {
+		return best
+	}
+
+	for _, offer := range offers {
+		offerType, _, _ := strings.Cut(offer, "/")
+		q, specificity := 0.0, -1
+		for _, value := range accept {
+			for field := range strings.SplitSeq(value, ",") {
+				mediaRange, params, _ := strings.Cut(field, ";")
+				mediaRange = strings.ToLower(strings.TrimSpace(mediaRange))
+
+				var s int
+				switch {
+				case mediaRange == offer:
+					s = 2
+				case mediaRange == offerType+"/*":
+					s = 1
+				case mediaRange == "*/*":
+					s = 0
+				default:
+					continue
+				}
+				if s <= specificity {
+					continue
+				}
+
+				specificity, q = s, 1.0
+				for param := range strings.SplitSeq(params, ";") {
+					if key, value, ok := strings.Cut(strings.TrimSpace(param), "="); ok && strings.TrimSpace(key) == "q" {
+						if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+							q = parsed
+						}
+					}
+				}
+			}
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
@@ -0,0 +1,129 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gorilla/mux"
+)
+
+func TestNegotiateContentType(t *testing.T) {
+	offers := []string{"application/problem+json", "application/json", "text/html", "text/plain"}
+	for _, test := range []struct {
+		accept []string
+		want   string
+	}{
+		{want: "application/problem+json"},
+		{accept: []string{"*/*"}, want: "application/problem+json"},
+		{accept: []string{"application/json"}, want: "application/json"},
+		{accept: []string{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"}, want: "text/html"},
+		{accept: []string{"text/*"}, want: "text/html"},
+		{accept: []string{"text/html;q=0.5", "text/plain"}, want: "text/plain"},
+		{accept: []string{"TEXT/PLAIN"}, want: "text/plain"},
+		{accept: []string{"*/*;q=0.1, text/html;q=0"}, want: "application/problem+json"},
+		{accept: []string{"image/png"}, want: "application/problem+json"},
+	} {
+		if got := negotiateContentType(test.accept, offers...); got != test.want {
+			t.Errorf("negotiateContentType(%q) = %q, want %q", test.accept, got, test.want)
+		}
+	}
+}
+
+func TestErrorPages(t *testing.T) {
+	content := http.FS(fstest.MapFS{
+		"site.css":          {Data: []byte("body {}")},
+		"errors/404.html":   {Data: []byte(`<h1>{{.Status}} {{.Title}}</h1><p>{{.Path}}</p>`)},
+		"errors/error.html": {Data: []byte(`<h1>{{.Status}}</h1><p>{{range .Allow}}{{.}};{{end}}</p>`)},
+	})
+	pages, err := newErrorPages(content, "errors")
+	if err != nil {
+		t.Fatalf("new error pages: %v", err)
+	}
+
+	handler, _, _ := newTelemetryTestHandler(t, func(router *mux.Router, telemetry *telemetry) {
+		router.NotFoundHandler = pages.handler(http.StatusNotFound)
+		router.MethodNotAllowedHandler = pages.handler(http.StatusMethodNotAllowed)
+		router.HandleFunc("/users/{id}", func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}).Methods(http.MethodGet, http.MethodDelete)
+		telemetry.staticRoute = router.PathPrefix("/").Handler(pages.fileServer(content)).Methods(http.MethodGet, http.MethodHead)
+	})
+
+	for _, test := range []struct {
+		name        string
+		method      string
+		path        string
+		accept      string
+		status      int
+		contentType string
+		body        string
+		allow       string
+	}{
+		{name: "file", method: http.MethodGet, path: "/site.css", status: http.StatusOK, body: "body {}"},
+		{name: "missing file html", method: http.MethodGet, path: "/missing.css", accept: "text/html", status: http.StatusNotFound, contentType: "text/html; charset=utf-8", body: "<h1>404 Not Found</h1><p>/missing.css</p>"},
+		{name: "missing file problem", method: http.MethodGet, path: "/missing.css", status: http.StatusNotFound, contentType: "application/problem+json", body: `"instance":"/missing.css"`},
+		{name: "missing file text", method: http.MethodGet, path: "/missing.css", accept: "text/plain", status: http.StatusNotFound, contentType: "text/plain; charset=utf-8", body: "404 page not found"},
+		{name: "missing file json", method: http.MethodGet, path: "/missing", accept: "application/json", status: http.StatusNotFound, contentType: "application/problem+json", body: `"status":404`},
+		{name: "method html", method: http.MethodPut, path: "/users/1", accept: "text/html", status: http.StatusMethodNotAllowed, contentType: "text/html; charset=utf-8", body: "<h1>405</h1><p>GET;DELETE;HEAD;</p>", allow: "GET, DELETE, HEAD"},
+		{name: "method problem", method: http.MethodPut, path: "/users/1", status: http.StatusMethodNotAllowed, contentType: "application/problem+json", body: "PUT is not allowed, the allowed methods are GET, DELETE, HEAD", allow: "GET, DELETE, HEAD"},
+		{name: "method text", method: http.MethodPost, path: "/site.css", accept: "text/plain", status: http.StatusMethodNotAllowed, contentType: "text/plain; charset=utf-8", body: "method not allowed", allow: "GET, HEAD"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(test.method, test.path, nil)
+			if test.accept != "" {
+				r.Header.Set("Accept", test.accept)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != test.status {
+				t.Errorf("status = %d, want %d", w.Code, test.status)
+			}
+			if test.contentType != "" && w.Header().Get("Content-Type") != test.contentType {
+				t.Errorf("content type = %q, want %q", w.Header().Get("Content-Type"), test.contentType)
+			}
+			if !strings.Contains(w.Body.String(), test.body) {
+				t.Errorf("body = %q, want it to contain %q", w.Body.String(), test.body)
+			}
+			if w.Header().Get("Allow") != test.allow {
+				t.Errorf("allow = %q, want %q", w.Header().Get("Allow"), test.allow)
+			}
+		})
+	}
+}
+
+func TestErrorPagesWithoutTemplates(t *testing.T) {
+	pages, err := newErrorPages(http.FS(fstest.MapFS{}), "errors")
+	if err != nil {
+		t.Fatalf("new error pages: %v", err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/missing", nil)
+	r.Header.Set("Accept", "text/html")
+	w := httptest.NewRecorder()
+	pages.handler(http.StatusNotFound).ServeHTTP(w, r)
+
+	if w.Code != http.StatusNotFound || w.Body.String() != "404 page not found\n" {
+		t.Errorf("response = %d %q", w.Code, w.Body.String())
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/missing", nil)
+	w = httptest.NewRecorder()
+	pages.handler(http.StatusNotFound).ServeHTTP(w, r)
+
+	var problem Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil || problem.Title != "Not Found" || problem.Instance != "/missing" {
+		t.Errorf("problem = %+v, %v", problem, err)
+	}
+}
+
+func TestErrorPagesInvalidTemplate(t *testing.T) {
+	_, err := newErrorPages(http.FS(fstest.MapFS{"errors/404.html": {Data: []byte("{{.Status")}}), "errors")
+	if err == nil || !strings.Contains(err.Error(), "404.html") {
+		t.Errorf("err = %v", err)
+	}
+}
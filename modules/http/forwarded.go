@@ -0,0 +1,214 @@
+package http
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// defaultTrustedProxies are the loopback ranges, for a reverse proxy on the
+// same host. Proxies on other hosts have to be trusted explicitly, since any
+// client in a trusted range can choose its own address.
+var defaultTrustedProxies = []string{
+	"127.0.0.0/8",
+	"::1/128",
+}
+
+// forwardingHeaders are removed from every request once they have been
+// applied, so handlers and telemetry can't read client supplied values.
+var forwardingHeaders = []string{"Forwarded", "X-Forwarded-For", "X-Forwarded-Proto", "X-Forwarded-Host", "X-Real-Ip"}
+
+// forwardedHop is one proxy hop described by the forwarding headers.
+type forwardedHop struct {
+	addr  netip.Addr
+	proto string
+	host  string
+}
+
+// parseForwardedHeader returns the canonical name of the forwarding header
+// the client address is taken from.
+func parseForwardedHeader(name string) (string, error) {
+	header := http.CanonicalHeaderKey(name)
+	switch header {
+	case "X-Forwarded-For", "Forwarded", "X-Real-Ip":
+		return header, nil
+	default:
+		return "", fmt.Errorf("unsupported forwarding header %q, use X-Forwarded-For, Forwarded or X-Real-IP", name)
+	}
+}
+
+// forwardedHandler applies the client address, scheme and host from the
+// forwarding header when the request comes from a trusted proxy. Other
+// forwarding headers are ignored, since proxies usually pass the ones they
+// don't set through from the client. The client is found by walking the
+// forwarded chain from the right, skipping trusted proxies, or, when hops is
+// set, by taking the address that many hops from the right.
+func forwardedHandler(trusted []netip.Prefix, header string, hops int, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer := parseForwardedAddr(r.RemoteAddr)
+		if !peer.IsValid() || !containsAddr(trusted, peer) {
+			next.ServeHTTP(w, withoutForwardingHeaders(r))
+			return
+		}
+
+		hop, ok := resolveClient(forwardedChain(r.Header, header), trusted, hops)
+
+		// a resolved hop means forwarding headers were present, so r is a copy
+		r = withoutForwardingHeaders(r)
+		if ok {
+			r.RemoteAddr = hop.addr.String()
+			if hop.proto == "http" || hop.proto == "https" {
+				r.URL.Scheme = hop.proto
+			}
+			if hop.host != "" {
+				r.Host = hop.host
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// resolveClient returns the client hop of chain, ordered from the client to
+// the nearest proxy.
+func resolveClient(chain []forwardedHop, trusted []netip.Prefix, hops int) (forwardedHop, bool) {
+	if len(chain) == 0 {
+		return forwardedHop{}, false
+	}
+
+	if hops > 0 {
+		idx := max(len(chain)-hops, 0)
+		return chain[idx], chain[idx].addr.IsValid()
+	}
+
+	var client forwardedHop
+	for i := len(chain) - 1; i >= 0; i-- {
+		// an obfuscated or unknown hop ends the walk at the last known address
+		if !chain[i].addr.IsValid() {
+			break
+		}
+		client = chain[i]
+		if !containsAddr(trusted, client.addr) {
+			break
+		}
+	}
+
+	return client, client.addr.IsValid()
+}
+
+// forwardedChain returns the hops from the RFC 7239 Forwarded header, or from
+// X-Forwarded-For or X-Real-IP with X-Forwarded-Proto and X-Forwarded-Host,
+// depending on header.
+func forwardedChain(h http.Header, header string) []forwardedHop {
+	var chain []forwardedHop
+	switch header {
+	case "Forwarded":
+		return parseForwarded(h.Values("Forwarded"))
+	case "X-Real-Ip":
+		if value := h.Get("X-Real-Ip"); value != "" {
+			chain = append(chain, forwardedHop{addr: parseForwardedAddr(value)})
+		}
+	default:
+		for _, value := range h.Values("X-Forwarded-For") {
+			for _, field := range strings.Split(value, ",") {
+				chain = append(chain, forwardedHop{addr: parseForwardedAddr(field)})
+			}
+		}
+	}
+
+	// the nearest proxy appends or overwrites these, so the last value is used
+	proto := strings.ToLower(lastListValue(h.Values("X-Forwarded-Proto")))
+	host := lastListValue(h.Values("X-Forwarded-Host"))
+	for i := range chain {
+		chain[i].proto, chain[i].host = proto, host
+	}
+
+	return chain
+}
+
+func lastListValue(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	fields := strings.Split(values[len(values)-1], ",")
+	return strings.TrimSpace(fields[len(fields)-1])
+}
+
+// parseForwarded parses Forwarded header values such as
+// `for=192.0.2.60;proto=https, for="[2001:db8::17]:4711"`.
+func parseForwarded(values []string) []forwardedHop {
+	var chain []forwardedHop
+	for _, value := range values {
+		for _, element := range splitQuoted(value, ',') {
+			var hop forwardedHop
+			for _, pair := range splitQuoted(element, ';') {
+				key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok {
+					continue
+				}
+				val = strings.Trim(strings.TrimSpace(val), `"`)
+
+				switch strings.ToLower(key) {
+				case "for":
+					hop.addr = parseForwardedAddr(val)
+				case "proto":
+					hop.proto = strings.ToLower(val)
+				case "host":
+					hop.host = val
+				}
+			}
+			chain = append(chain, hop)
+		}
+	}
+	return chain
+}
+
+// splitQuoted splits s on sep outside of double quoted strings.
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case sep:
+			if !quoted {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// parseForwardedAddr parses an address with an optional port, returning the
+// zero Addr for unknown or obfuscated identifiers.
+func parseForwardedAddr(value string) netip.Addr {
+	value = strings.TrimSpace(value)
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	addr, err := netip.ParseAddr(strings.Trim(value, "[]"))
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
+
+// withoutForwardingHeaders returns a copy of r without forwarding headers, or
+// r itself when it has none.
+func withoutForwardingHeaders(r *http.Request) *http.Request {
+	for _, header := range forwardingHeaders {
+		if _, ok := r.Header[header]; ok {
+			r = r.Clone(r.Context())
+			for _, header := range forwardingHeaders {
+				r.Header.Del(header)
+			}
+			return r
+		}
+	}
+	return r
+}
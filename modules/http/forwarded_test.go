@@ -0,0 +1,157 @@
+package http
+
+import (
+	"cmp"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestForwardedHandler(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		header     string
+		hops       int
+		remoteAddr string
+		headers    map[string]string
+		wantAddr   string
+		wantScheme string
+		wantHost   string
+	}{
+		{
+			name:       "untrusted peer",
+			remoteAddr: "203.0.113.9:1234",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1", "X-Forwarded-Proto": "https", "X-Real-Ip": "198.51.100.2"},
+			wantAddr:   "203.0.113.9:1234",
+			wantHost:   "example.com",
+		},
+		{
+			name:       "no headers",
+			remoteAddr: "10.0.0.1:1234",
+			wantAddr:   "10.0.0.1:1234",
+			wantHost:   "example.com",
+		},
+		{
+			name:       "x-forwarded-for",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1", "X-Forwarded-Proto": "https", "X-Forwarded-Host": "public.example.com"},
+			wantAddr:   "198.51.100.1",
+			wantScheme: "https",
+			wantHost:   "public.example.com",
+		},
+		{
+			name:       "spoofed chain",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.1, 10.0.0.2"},
+			wantAddr:   "198.51.100.1",
+			wantHost:   "example.com",
+		},
+		{
+			name:       "hop count",
+			hops:       2,
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.1, 203.0.113.5"},
+			wantAddr:   "198.51.100.1",
+			wantHost:   "example.com",
+		},
+		{
+			name:       "x-real-ip",
+			header:     "X-Real-IP",
+			remoteAddr: "127.0.0.1:1234",
+			headers:    map[string]string{"X-Real-Ip": "198.51.100.1"},
+			wantAddr:   "198.51.100.1",
+			wantHost:   "example.com",
+		},
+		{
+			name:       "forwarded",
+			header:     "Forwarded",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"Forwarded": `for=1.2.3.4, for="[2001:db8::17]:4711";proto=https;host="public.example.com", for=10.0.0.2;proto=http`},
+			wantAddr:   "2001:db8::17",
+			wantScheme: "https",
+			wantHost:   "public.example.com",
+		},
+		{
+			name:       "forwarded obfuscated",
+			header:     "Forwarded",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"Forwarded": `for=_hidden, for=10.0.0.2`},
+			wantAddr:   "10.0.0.2",
+			wantHost:   "example.com",
+		},
+		{
+			name:       "forwarded ignored",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"Forwarded": "for=198.51.100.1;host=spoofed.example.com", "X-Forwarded-For": "198.51.100.2"},
+			wantAddr:   "198.51.100.2",
+			wantHost:   "example.com",
+		},
+		{
+			name:       "x-real-ip ignored",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Real-Ip": "198.51.100.1"},
+			wantAddr:   "10.0.0.1:1234",
+			wantHost:   "example.com",
+		},
+		{
+			name:       "private peer untrusted by default",
+			remoteAddr: "192.168.1.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1"},
+			wantAddr:   "192.168.1.1:1234",
+			wantHost:   "example.com",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			trusted, err := parsePrefixes(append([]string{"10.0.0.0/8"}, defaultTrustedProxies...))
+			if err != nil {
+				t.Fatalf("parse prefixes: %v", err)
+			}
+			header, err := parseForwardedHeader(cmp.Or(test.header, "X-Forwarded-For"))
+			if err != nil {
+				t.Fatalf("parse forwarded header: %v", err)
+			}
+
+			var got *http.Request
+			handler := forwardedHandler(trusted, header, test.hops, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = r
+			}))
+
+			request := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			request.URL.Scheme = ""
+			request.RemoteAddr = test.remoteAddr
+			for key, value := range test.headers {
+				request.Header.Set(key, value)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), request)
+
+			if got.RemoteAddr != test.wantAddr {
+				t.Errorf("remote address = %q, want %q", got.RemoteAddr, test.wantAddr)
+			}
+			if got.URL.Scheme != test.wantScheme {
+				t.Errorf("scheme = %q, want %q", got.URL.Scheme, test.wantScheme)
+			}
+			if got.Host != test.wantHost {
+				t.Errorf("host = %q, want %q", got.Host, test.wantHost)
+			}
+			for _, header := range forwardingHeaders {
+				if value := got.Header.Get(header); value != "" {
+					t.Errorf("forwarding header %s = %q was passed on", header, value)
+				}
+			}
+			if request.RemoteAddr != test.remoteAddr {
+				t.Error("original request was modified")
+			}
+		})
+	}
+}
+
+func TestParseForwardedHeader(t *testing.T) {
+	for name, want := range map[string]string{"x-forwarded-for": "X-Forwarded-For", "Forwarded": "Forwarded", "X-Real-IP": "X-Real-Ip"} {
+		if got, err := parseForwardedHeader(name); err != nil || got != want {
+			t.Errorf("parseForwardedHeader(%q) = %q, %v, want %q", name, got, err, want)
+		}
+	}
+	if _, err := parseForwardedHeader("X-Client-IP"); err == nil {
+		t.Error("unsupported header succeeded")
+	}
+}
@@ -0,0 +1,31 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+)
+
+type h2cConfig struct {
+	Enabled              bool `setting:"enabled" description:"Serve HTTP/2 over cleartext connections to clients with prior knowledge"`
+	MaxConcurrentStreams int  `setting:"max_concurrent_streams" description:"The maximum number of concurrent streams per HTTP/2 connection, zero for the default of 250"`
+	MaxReadFrameSize     int  `setting:"max_read_frame_size" description:"The largest HTTP/2 frame accepted from clients in bytes, zero for the default of 1MB"`
+}
+
+// configureH2C serves HTTP/2 with prior knowledge on the server's cleartext
+// connections, alongside HTTP/1. It must be called before the server starts.
+func (m *module) configureH2C() error {
+	cfg := m.cfg.HTTP.H2C
+	if cfg.MaxConcurrentStreams < 0 || cfg.MaxReadFrameSize < 0 {
+		return errors.New("http.h2c limits must not be negative")
+	}
+
+	m.server.Protocols = new(http.Protocols)
+	m.server.Protocols.SetHTTP1(true)
+	m.server.Protocols.SetUnencryptedHTTP2(true)
+	m.server.HTTP2 = &http.HTTP2Config{
+		MaxConcurrentStreams: cfg.MaxConcurrentStreams,
+		MaxReadFrameSize:     cfg.MaxReadFrameSize,
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package http
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestH2CPriorKnowledge(t *testing.T) {
+	handler, recorder, _ := newTelemetryTestHandler(t, func(router *mux.Router, _ *telemetry) {
+		router.HandleFunc("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(r.Proto))
+		}).Methods(http.MethodGet)
+	})
+	server := newH2CTestServer(t, handler)
+
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+	response, err := client.Get(server.URL + "/users/one")
+	if err != nil {
+		t.Fatalf("h2c request: %v", err)
+	}
+	_ = response.Body.Close()
+
+	if response.ProtoMajor != 2 {
+		t.Errorf("response protocol = %s, want HTTP/2.0", response.Proto)
+	}
+	assertSpanRoute(t, onlyEndedSpan(t, recorder), "GET /users/{id}", "/users/{id}")
+}
+
+func TestH2CUpgradeNotSupported(t *testing.T) {
+	server := newH2CTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Proto))
+	}))
+
+	request, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	request.Header.Set("Connection", "Upgrade, HTTP2-Settings")
+	request.Header.Set("Upgrade", "h2c")
+	request.Header.Set("HTTP2-Settings", "")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("upgrade request: %v", err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	_ = response.Body.Close()
+
+	// the upgrade is ignored and the request served over HTTP/1
+	if response.StatusCode != http.StatusOK || string(body) != "HTTP/1.1" {
+		t.Errorf("response = %d %q, want 200 HTTP/1.1", response.StatusCode, body)
+	}
+}
+
+func TestH2CHTTP1(t *testing.T) {
+	server := newH2CTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Proto))
+	}))
+
+	response, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("HTTP/1 request: %v", err)
+	}
+	_ = response.Body.Close()
+	if response.ProtoMajor != 1 {
+		t.Errorf("response protocol = %s, want HTTP/1.1", response.Proto)
+	}
+}
+
+func newH2CTestServer(t *testing.T, handler http.Handler) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewUnstartedServer(handler)
+	m := &module{cfg: &cfg{}, server: server.Config}
+	if err := m.configureH2C(); err != nil {
+		t.Fatalf("configure h2c: %v", err)
+	}
+	server.Start()
+	t.Cleanup(server.Close)
+
+	return server
+}
@@ -0,0 +1,297 @@
+package http
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Validator is implemented by request types that check themselves once
+// decoded. An error that isn't a *Problem responds with 422 Unprocessable
+// Content and the error as its detail.
+type Validator interface {
+	Validate() error
+}
+
+// Handle returns a JSON handler for fn, described in the OpenAPI document by
+// op with its request and response types filled in from Req and Resp.
+//
+// Fields of Req tagged path, query or header are decoded from the route
+// variable, query parameter or header of that name, and the other fields
+// from a JSON request body. Req is then validated when it implements
+// Validator, and the value returned by fn is encoded as JSON with op.Status,
+// or 200 OK. Errors respond with problem details as described by
+// ProblemFromError, and are recorded on the request span.
+func Handle[Req, Resp any](op Operation, fn func(ctx context.Context, req Req) (Resp, error)) http.Handler {
+	decoder := newRequestDecoder(reflect.TypeFor[Req]())
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if op.Request == nil && decoder.body {
+		op.Request = *new(Req)
+	}
+	if op.Response == nil && status != http.StatusNoContent {
+		op.Response = *new(Resp)
+	}
+	op.Parameters = append(decoder.parameters(), op.Parameters...)
+
+	return Document(op, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Req
+		if err := decoder.decode(r, &req); err != nil {
+			handleError(w, r, err)
+			return
+		}
+
+		if validator, ok := any(&req).(Validator); ok {
+			if err := validator.Validate(); err != nil {
+				var problem *Problem
+				if !errors.As(err, &problem) {
+					err = &Problem{Title: http.StatusText(http.StatusUnprocessableEntity), Status: http.StatusUnprocessableEntity, Detail: err.Error(), err: err}
+				}
+				handleError(w, r, err)
+				return
+			}
+		}
+
+		resp, err := fn(r.Context(), req)
+		if err != nil {
+			handleError(w, r, err)
+			return
+		}
+
+		if status == http.StatusNoContent {
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			trace.SpanFromContext(r.Context()).RecordError(err)
+		}
+	}))
+}
+
+// handleError records err on the request span and responds with its
+// problem details. Server errors set the span status and are logged, since
+// their detail isn't sent to the client.
+func handleError(w http.ResponseWriter, r *http.Request, err error) {
+	problem := ProblemFromError(err)
+
+	span := trace.SpanFromContext(r.Context())
+	span.RecordError(err)
+	if problem.Status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, err.Error())
+		slog.ErrorContext(r.Context(), "HTTP Handler Failure", "method", r.Method, "path", r.URL.Path, "status", problem.Status, "err", err)
+	}
+
+	WriteProblem(w, problem)
+}
+
+// requestDecoder decodes requests into a struct type by its field tags.
+type requestDecoder struct {
+	fields []requestField
+	body   bool
+}
+
+type requestField struct {
+	index []int
+	name  string
+	in    string
+	typ   reflect.Type
+}
+
+var textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+
+func newRequestDecoder(t reflect.Type) *requestDecoder {
+	d := &requestDecoder{}
+	if t.Kind() != reflect.Struct {
+		// non struct requests, such as []Item, are decoded from the body
+		d.body = t.Kind() != reflect.Interface
+		return d
+	}
+
+	for field := range t.Fields() {
+		if !field.IsExported() {
+			continue
+		}
+
+		var in, name string
+		for _, location := range []string{"path", "query", "header"} {
+			if tag := field.Tag.Get(location); tag != "" {
+				in, name = location, tag
+				break
+			}
+		}
+		if in == "" {
+			if field.Tag.Get("json") != "-" {
+				d.body = true
+			}
+			continue
+		}
+
+		if !decodableParameter(field.Type) {
+			panic(fmt.Sprintf("http: %s parameter %q of %s has unsupported type %s", in, name, t, field.Type))
+		}
+		d.fields = append(d.fields, requestField{index: field.Index, name: name, in: in, typ: field.Type})
+	}
+	return d
+}
+
+func (d *requestDecoder) parameters() []Parameter {
+	var parameters []Parameter
+	for _, field := range d.fields {
+		parameters = append(parameters, Parameter{Name: field.name, In: field.in, Required: field.in == "path", Type: reflect.Zero(field.typ).Interface()})
+	}
+	return parameters
+}
+
+func (d *requestDecoder) decode(r *http.Request, req any) error {
+	v := reflect.ValueOf(req).Elem()
+
+	if d.body && r.Body != nil && r.Body != http.NoBody && r.ContentLength != 0 {
+		if contentType := r.Header.Get("Content-Type"); contentType != "" {
+			mediaType, _, _ := mime.ParseMediaType(contentType)
+			if mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json") {
+				return NewProblem(http.StatusUnsupportedMediaType, "request body must be application/json")
+			}
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil && !errors.Is(err, io.EOF) {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				return err
+			}
+			return Problemf(http.StatusBadRequest, "invalid request body: %w", err)
+		}
+
+		// parameters only come from their location, never from a body
+		// field of the same name
+		for _, field := range d.fields {
+			v.FieldByIndex(field.index).SetZero()
+		}
+	}
+
+	vars := mux.Vars(r)
+	query := r.URL.Query()
+	for _, field := range d.fields {
+		var values []string
+		switch field.in {
+		case "path":
+			if value, ok := vars[field.name]; ok {
+				values = []string{value}
+			}
+		case "query":
+			values = query[field.name]
+		case "header":
+			values = r.Header.Values(field.name)
+		}
+		if len(values) == 0 {
+			continue
+		}
+
+		if err := setParameter(v.FieldByIndex(field.index), values); err != nil {
+			return Problemf(http.StatusBadRequest, "invalid %s parameter %q: %w", field.in, field.name, err)
+		}
+	}
+	return nil
+}
+
+// decodableParameter reports whether values of t can be parsed from text.
+func decodableParameter(t reflect.Type) bool {
+	if reflect.PointerTo(t).Implements(textUnmarshalerType) || t == reflect.TypeFor[time.Duration]() {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() != reflect.Slice && decodableParameter(t.Elem())
+	case reflect.Pointer:
+		return decodableParameter(t.Elem())
+	default:
+		return false
+	}
+}
+
+func setParameter(v reflect.Value, values []string) error {
+	switch {
+	case v.Kind() == reflect.Slice && !v.Addr().Type().Implements(textUnmarshalerType):
+		slice := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := setParameter(slice.Index(i), []string{value}); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	case v.Kind() == reflect.Pointer:
+		elem := reflect.New(v.Type().Elem())
+		if err := setParameter(elem.Elem(), values); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	}
+
+	value := values[0]
+	if unmarshaler, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return unmarshaler.UnmarshalText([]byte(value))
+	}
+	if v.Type() == reflect.TypeFor[time.Duration]() {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type testUpdateInvoice struct {
+	ID      int           `path:"id"`
+	Notify  bool          `query:"notify"`
+	Tags    []string      `query:"tag"`
+	Timeout time.Duration `query:"timeout"`
+	Tenant  *string       `header:"X-Tenant"`
+	Amount  float64       `json:"amount"`
+}
+
+func (r testUpdateInvoice) Validate() error {
+	if r.Amount < 0 {
+		return errors.New("amount must not be negative")
+	}
+	return nil
+}
+
+var errTestInvoiceLocked = &Problem{Status: http.StatusConflict, Detail: "invoice is locked"}
+
+func TestHandle(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	t.Cleanup(func() { _ = provider.Shutdown(t.Context()) })
+
+	var got testUpdateInvoice
+	router := mux.NewRouter()
+	router.Handle("/invoices/{id}", Handle(Operation{Status: http.StatusAccepted}, func(ctx context.Context, req testUpdateInvoice) (map[string]float64, error) {
+		got = req
+		switch req.ID {
+		case 2:
+			return nil, errTestInvoiceLocked
+		case 3:
+			return nil, errors.New("database is down")
+		}
+		return map[string]float64{"amount": req.Amount}, nil
+	})).Methods(http.MethodPut)
+	handler := otelhttp.NewHandler(router, "test", otelhttp.WithTracerProvider(provider))
+
+	for _, test := range []struct {
+		name        string
+		url         string
+		contentType string
+		body        string
+		status      int
+		response    string
+		spanStatus  codes.Code
+	}{
+		{name: "decoded", url: "/invoices/1?notify=true&tag=a&tag=b&timeout=5s", body: `{"amount": 12.5}`, status: http.StatusAccepted, response: `{"amount":12.5}`},
+		{name: "no body", url: "/invoices/1", status: http.StatusAccepted, response: `{"amount":0}`},
+		{name: "invalid json", url: "/invoices/1", body: `{"amount":`, status: http.StatusBadRequest},
+		{name: "invalid query", url: "/invoices/1?notify=maybe", status: http.StatusBadRequest},
+		{name: "invalid path", url: "/invoices/one", status: http.StatusBadRequest},
+		{name: "content type", url: "/invoices/1", contentType: "text/plain", body: "12", status: http.StatusUnsupportedMediaType},
+		{name: "validation", url: "/invoices/1", body: `{"amount": -1}`, status: http.StatusUnprocessableEntity, response: `"detail":"amount must not be negative"`},
+		{name: "problem", url: "/invoices/2", status: http.StatusConflict, response: `{"title":"Conflict","status":409,"detail":"invoice is locked"}`},
+		{name: "failure", url: "/invoices/3", status: http.StatusInternalServerError, response: `{"title":"Internal Server Error","status":500}`, spanStatus: codes.Error},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPut, test.url, strings.NewReader(test.body))
+			r.Header.Set("X-Tenant", "acme")
+			if test.contentType != "" {
+				r.Header.Set("Content-Type", test.contentType)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != test.status {
+				t.Errorf("status = %d, want %d: %s", w.Code, test.status, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), test.response) {
+				t.Errorf("body = %s, want %s", w.Body.String(), test.response)
+			}
+
+			wantType := "application/json"
+			if test.status >= http.StatusBadRequest {
+				wantType = "application/problem+json"
+			}
+			if got := w.Header().Get("Content-Type"); got != wantType {
+				t.Errorf("Content-Type = %q, want %q", got, wantType)
+			}
+
+			spans := recorder.Ended()
+			span := spans[len(spans)-1]
+			if span.Status().Code != test.spanStatus {
+				t.Errorf("span status = %v, want %v", span.Status().Code, test.spanStatus)
+			}
+			var exception bool
+			for _, event := range span.Events() {
+				exception = exception || event.Name == "exception"
+			}
+			if exception != (test.status >= http.StatusBadRequest) {
+				t.Errorf("span exception event = %t", exception)
+			}
+		})
+	}
+
+	if got.ID != 3 || got.Tenant == nil || *got.Tenant != "acme" {
+		t.Errorf("last request = %+v", got)
+	}
+}
+
+func TestHandleDecodesParameters(t *testing.T) {
+	var got testUpdateInvoice
+	router := mux.NewRouter()
+	router.Handle("/invoices/{id}", Handle(Operation{}, func(ctx context.Context, req testUpdateInvoice) (struct{}, error) {
+		got = req
+		return struct{}{}, nil
+	})).Methods(http.MethodPut)
+
+	r := httptest.NewRequest(http.MethodPut, "/invoices/7?notify=true&tag=a&tag=b&timeout=5s", strings.NewReader(`{"amount": 12.5}`))
+	router.ServeHTTP(httptest.NewRecorder(), r)
+
+	if got.ID != 7 || !got.Notify || strings.Join(got.Tags, ",") != "a,b" || got.Timeout != 5*time.Second || got.Amount != 12.5 || got.Tenant != nil {
+		t.Errorf("request = %+v", got)
+	}
+
+	// parameters can't be set through body fields of the same name
+	got = testUpdateInvoice{}
+	r = httptest.NewRequest(http.MethodPut, "/invoices/7", strings.NewReader(`{"amount": 1, "ID": 9, "Notify": true, "Tags": ["x"], "Tenant": "spoofed"}`))
+	router.ServeHTTP(httptest.NewRecorder(), r)
+
+	if got.ID != 7 || got.Notify || got.Tags != nil || got.Tenant != nil || got.Amount != 1 {
+		t.Errorf("request with parameters in the body = %+v", got)
+	}
+
+	document, err := openAPIDocument(router, openAPIConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, _ := json.Marshal(document)
+	for _, want := range []string{
+		`{"in":"path","name":"id","required":true,"schema":{"format":"int64","type":"integer"}}`,
+		`{"in":"query","name":"tag","schema":{"items":{"type":"string"},"type":"array"}}`,
+		`{"in":"header","name":"X-Tenant","schema":{"type":"string"}}`,
+		`"testUpdateInvoice":{"properties":{"amount":{"format":"double","type":"number"}},"required":["amount"],"type":"object"}`,
+	} {
+		if !strings.Contains(string(encoded), want) {
+			t.Errorf("document %s doesn't contain %s", encoded, want)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tcpKeepAliveListener sets TCP keep-alive timeouts on accepted connections. It's used so dead TCP connections (e.g. closing laptop mid-download) eventually go away.
+type tcpKeepAliveListener struct {
+	*net.TCPListener
+}
+
+func (ln tcpKeepAliveListener) Accept() (net.Conn, error) {
+	tc, err := ln.AcceptTCP()
+	if err != nil {
+		return nil, err
+	}
+
+	_ = tc.SetKeepAlive(true)
+	_ = tc.SetKeepAlivePeriod(3 * time.Minute)
+
+	return tc, nil
+}
+
+type proxyProtocolConfig struct {
+	Enabled       bool          `setting:"enabled" description:"Accept PROXY protocol v1 and v2 headers from trusted upstreams"`
+	TrustedCIDRs  []string      `setting:"trusted_cidrs" description:"The upstream address ranges allowed to send PROXY protocol headers"`
+	HeaderTimeout time.Duration `setting:"header_timeout" description:"The maximum duration for reading a PROXY protocol header, which must be positive"`
+}
+
+// parsePrefixes parses CIDR ranges, accepting single addresses as host ranges.
+func parsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// containsAddr reports whether addr is in any of prefixes.
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyProtocolListener reads PROXY protocol headers sent by trusted upstreams,
+// such as HAProxy or AWS NLB, and reports the client address they carry as the
+// connection's remote address. Connections from other peers, and trusted
+// connections without a header, are served unchanged.
+type proxyProtocolListener struct {
+	net.Listener
+	trusted []netip.Prefix
+	timeout time.Duration
+}
+
+func (ln *proxyProtocolListener) Accept() (net.Conn, error) {
+	conn, err := ln.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	addr, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok || !containsAddr(ln.trusted, addr.AddrPort().Addr()) {
+		return conn, nil
+	}
+
+	// the header is read on first use, in the connection's own goroutine,
+	// so a slow upstream does not block Accept
+	return &proxyProtocolConn{Conn: conn, reader: bufio.NewReader(conn), timeout: ln.timeout}, nil
+}
+
+type proxyProtocolConn struct {
+	net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+
+	once       sync.Once
+	err        error
+	remoteAddr net.Addr
+	localAddr  net.Addr
+}
+
+func (c *proxyProtocolConn) init() {
+	c.once.Do(func() {
+		_ = c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+		defer func() { _ = c.Conn.SetReadDeadline(time.Time{}) }()
+
+		c.remoteAddr, c.localAddr, c.err = readProxyHeader(c.reader)
+		if c.err != nil {
+			c.err = fmt.Errorf("invalid PROXY protocol header from %s: %w", c.Conn.RemoteAddr(), c.err)
+			_ = c.Conn.Close()
+		}
+	})
+}
+
+func (c *proxyProtocolConn) Read(p []byte) (int, error) {
+	if c.init(); c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(p)
+}
+
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	if c.init(); c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *proxyProtocolConn) LocalAddr() net.Addr {
+	if c.init(); c.localAddr != nil {
+		return c.localAddr
+	}
+	return c.Conn.LocalAddr()
+}
+
+var (
+	proxyV1Prefix    = []byte("PROXY ")
+	proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+// readProxyHeader consumes a PROXY protocol v1 or v2 header from r and returns
+// the source and destination addresses it carries. Both are nil when there is
+// no header or it does not carry addresses, such as health checks sent with
+// the LOCAL command or an UNKNOWN protocol.
+func readProxyHeader(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	if peek, _ := r.Peek(len(proxyV2Signature)); bytes.Equal(peek, proxyV2Signature) {
+		return readProxyHeaderV2(r)
+	}
+	if peek, _ := r.Peek(len(proxyV1Prefix)); bytes.Equal(peek, proxyV1Prefix) {
+		return readProxyHeaderV1(r)
+	}
+	return nil, nil, nil
+}
+
+// readProxyHeaderV1 parses "PROXY TCP4 src dst sport dport\r\n".
+func readProxyHeaderV1(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	// the longest valid v1 header is 107 bytes
+	var line []byte
+	for len(line) < 107 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, nil, errors.New("v1 header is not terminated")
+	}
+
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, nil, fmt.Errorf("malformed v1 header %q", line)
+	}
+
+	src, err := parseProxyAddr(fields[2], fields[4])
+	if err != nil {
+		return nil, nil, err
+	}
+	dst, err := parseProxyAddr(fields[3], fields[5])
+	if err != nil {
+		return nil, nil, err
+	}
+	return src, dst, nil
+}
+
+func parseProxyAddr(ip, port string) (*net.TCPAddr, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q", ip)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q", port)
+	}
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr, uint16(p))), nil
+}
+
+// readProxyHeaderV2 parses the binary v2 header. TLVs are skipped.
+func readProxyHeaderV2(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, err
+	}
+
+	if version := header[12] >> 4; version != 2 {
+		return nil, nil, fmt.Errorf("unsupported v2 version %d", version)
+	}
+	command := header[12] & 0x0f
+	family := header[13]
+
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, nil, err
+	}
+
+	switch command {
+	case 0x0: // LOCAL
+		return nil, nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, nil, fmt.Errorf("unsupported v2 command %d", command)
+	}
+
+	var size int
+	switch family {
+	case 0x11: // TCP over IPv4
+		size = 4
+	case 0x21: // TCP over IPv6
+		size = 16
+	default:
+		// UDP and unix sockets carry no TCP client address
+		return nil, nil, nil
+	}
+
+	if len(payload) < 2*size+4 {
+		return nil, nil, errors.New("v2 address block is truncated")
+	}
+
+	srcIP, _ := netip.AddrFromSlice(payload[:size])
+	dstIP, _ := netip.AddrFromSlice(payload[size : 2*size])
+	srcPort := binary.BigEndian.Uint16(payload[2*size:])
+	dstPort := binary.BigEndian.Uint16(payload[2*size+2:])
+
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(srcIP, srcPort)),
+		net.TCPAddrFromAddrPort(netip.AddrPortFrom(dstIP, dstPort)), nil
+}
@@ -0,0 +1,131 @@
+package http
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProxyProtocolListener(t *testing.T) {
+	v2 := func(command, family byte, addrs []byte) string {
+		header := append([]byte{}, proxyV2Signature...)
+		header = append(header, 0x20|command, family)
+		header = binary.BigEndian.AppendUint16(header, uint16(len(addrs)))
+		return string(append(header, addrs...))
+	}
+	v2IPv4 := []byte{203, 0, 113, 7, 10, 0, 0, 1, 0x30, 0x39, 0x01, 0xbb}
+	v2IPv6 := append(append(netip.MustParseAddr("2001:db8::7").AsSlice(), netip.MustParseAddr("2001:db8::1").AsSlice()...), 0x30, 0x39, 0x01, 0xbb)
+
+	for _, test := range []struct {
+		name    string
+		trusted string
+		header  string
+		want    string
+	}{
+		{name: "v1 tcp4", trusted: "127.0.0.0/8", header: "PROXY TCP4 203.0.113.7 10.0.0.1 12345 443\r\n", want: "203.0.113.7:12345"},
+		{name: "v1 tcp6", trusted: "127.0.0.1", header: "PROXY TCP6 2001:db8::7 2001:db8::1 12345 443\r\n", want: "[2001:db8::7]:12345"},
+		{name: "v1 unknown", trusted: "127.0.0.0/8", header: "PROXY UNKNOWN\r\n", want: "127.0.0.1"},
+		{name: "v2 tcp4", trusted: "127.0.0.0/8", header: v2(0x1, 0x11, v2IPv4), want: "203.0.113.7:12345"},
+		{name: "v2 tcp6", trusted: "127.0.0.0/8", header: v2(0x1, 0x21, v2IPv6), want: "[2001:db8::7]:12345"},
+		{name: "v2 local", trusted: "127.0.0.0/8", header: v2(0x0, 0x00, nil), want: "127.0.0.1"},
+		{name: "no header", trusted: "127.0.0.0/8", want: "127.0.0.1"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			addr := serveProxyProtocol(t, test.trusted)
+			got := proxyProtocolRequest(t, addr, test.header)
+			if !strings.HasPrefix(got, test.want) {
+				t.Errorf("remote address = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestProxyProtocolListenerUntrusted(t *testing.T) {
+	addr := serveProxyProtocol(t, "192.0.2.0/24")
+
+	// an untrusted peer's header is not interpreted, so the request is invalid
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	_, _ = io.WriteString(conn, "PROXY TCP4 203.0.113.7 10.0.0.1 12345 443\r\nGET / HTTP/1.1\r\nHost: test\r\n\r\n")
+	response, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("read response: %v", err)
+	}
+	_ = response.Body.Close()
+	if response.StatusCode != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", response.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestProxyProtocolListenerMalformed(t *testing.T) {
+	addr := serveProxyProtocol(t, "127.0.0.0/8")
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	_, _ = io.WriteString(conn, "PROXY TCP4 not-an-address 10.0.0.1 12345 443\r\nGET / HTTP/1.1\r\nHost: test\r\n\r\n")
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := http.ReadResponse(bufio.NewReader(conn), nil); err == nil {
+		t.Error("malformed header was served")
+	}
+}
+
+func serveProxyProtocol(t *testing.T, trusted string) string {
+	t.Helper()
+
+	prefixes, err := parsePrefixes([]string{trusted})
+	if err != nil {
+		t.Fatalf("parse prefixes: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.RemoteAddr)
+	})}
+	go func() {
+		_ = server.Serve(&proxyProtocolListener{Listener: listener, trusted: prefixes, timeout: time.Second})
+	}()
+	t.Cleanup(func() { _ = server.Close() })
+
+	return listener.Addr().String()
+}
+
+func proxyProtocolRequest(t *testing.T, addr, header string) string {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	_, _ = io.WriteString(conn, header+"GET / HTTP/1.1\r\nHost: test\r\nConnection: close\r\n\r\n")
+	response, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("read response: %v", err)
+	}
+	defer func() { _ = response.Body.Close() }()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	return string(body)
+}
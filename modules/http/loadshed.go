@@ -0,0 +1,350 @@
+package http
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type loadShedConfig struct {
+	Enabled       bool                  `setting:"enabled" description:"Reject requests with 503 when more requests are in flight than the server can handle"`
+	MaxInFlight   int                   `setting:"max_in_flight" description:"The maximum number of requests handled at once, the ceiling of the adaptive limit"`
+	MinInFlight   int                   `setting:"min_in_flight" description:"The floor of the adaptive limit"`
+	QueueSize     int                   `setting:"queue_size" description:"The maximum number of requests waiting for a slot before requests are shed"`
+	QueueTimeout  time.Duration         `setting:"queue_timeout" description:"The maximum duration a request waits for a slot"`
+	RetryAfter    time.Duration         `setting:"retry_after" description:"The delay suggested to shed clients by the Retry-After header"`
+	Adaptive      string                `setting:"adaptive" description:"Adjust the limit from observed latency: none, aimd or gradient"`
+	LatencyTarget time.Duration         `setting:"latency_target" description:"The latency above which the aimd limit is decreased"`
+	ExemptPaths   []string              `setting:"exempt_paths" description:"Path prefixes the server wide limit doesn't apply to, such as health checks"`
+	Routes        []loadShedRouteConfig `config:"route,block"`
+}
+
+type loadShedRouteConfig struct {
+	Route       string `setting:"route" description:"The route template the limit applies to, such as /users/{id}"`
+	MaxInFlight int    `setting:"max_in_flight" description:"The maximum number of requests to the route handled at once"`
+	QueueSize   int    `setting:"queue_size" description:"The maximum number of requests to the route waiting for a slot"`
+}
+
+// loadShedder limits the requests in flight across the server and for
+// configured routes, queueing briefly and then shedding the excess.
+type loadShedder struct {
+	retryAfter   time.Duration
+	exempt       []string
+	global       *concurrencyLimiter
+	routes       map[string]*concurrencyLimiter
+	shed         metric.Int64Counter
+	registration metric.Registration
+}
+
+func newLoadShedder(meter metric.Meter, cfg loadShedConfig) (*loadShedder, error) {
+	newAlgorithm, err := parseLimitAlgorithm(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.MaxInFlight <= 0 {
+		return nil, errors.New("max_in_flight must be positive")
+	}
+
+	s := &loadShedder{
+		retryAfter: cfg.RetryAfter,
+		exempt:     cfg.ExemptPaths,
+		global:     newConcurrencyLimiter("global", cfg.MaxInFlight, max(cfg.MinInFlight, 1), cfg.QueueSize, cfg.QueueTimeout, newAlgorithm()),
+		routes:     make(map[string]*concurrencyLimiter, len(cfg.Routes)),
+	}
+	for _, route := range cfg.Routes {
+		if route.Route == "" || route.MaxInFlight <= 0 {
+			return nil, fmt.Errorf("route %q needs a route template and a positive max_in_flight", route.Route)
+		}
+		if _, exists := s.routes[route.Route]; exists {
+			return nil, fmt.Errorf("route %q is configured more than once", route.Route)
+		}
+		minInFlight := min(max(cfg.MinInFlight, 1), route.MaxInFlight)
+		s.routes[route.Route] = newConcurrencyLimiter(route.Route, route.MaxInFlight, minInFlight, route.QueueSize, cfg.QueueTimeout, newAlgorithm())
+	}
+
+	s.shed, err = meter.Int64Counter(
+		"http.server.request.shed",
+		metric.WithUnit("{request}"),
+		metric.WithDescription("Number of requests rejected because too many requests were in flight"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create shed request counter: %w", err)
+	}
+
+	limit, err := meter.Int64ObservableGauge(
+		"http.server.concurrency.limit",
+		metric.WithUnit("{request}"),
+		metric.WithDescription("The current limit of requests handled at once"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create concurrency limit gauge: %w", err)
+	}
+	inFlight, err := meter.Int64ObservableGauge(
+		"http.server.concurrency.in_flight",
+		metric.WithUnit("{request}"),
+		metric.WithDescription("The number of requests currently counted against the concurrency limit"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create in flight gauge: %w", err)
+	}
+
+	s.registration, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		for _, l := range s.limiters() {
+			current, active := l.stats()
+			attrs := metric.WithAttributes(attribute.String("load_shed.scope", l.name))
+			o.ObserveInt64(limit, int64(current), attrs)
+			o.ObserveInt64(inFlight, int64(active), attrs)
+		}
+		return nil
+	}, limit, inFlight)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register concurrency gauges: %w", err)
+	}
+
+	return s, nil
+}
+
+func (s *loadShedder) limiters() []*concurrencyLimiter {
+	limiters := []*concurrencyLimiter{s.global}
+	for _, l := range s.routes {
+		limiters = append(limiters, l)
+	}
+	return limiters
+}
+
+// handler applies the server wide limit to every request outside the exempt
+// paths. Health checks are exempt by default, so an overloaded instance isn't
+// restarted or drained for being busy.
+func (s *loadShedder) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, path := range s.exempt {
+			if hasPathPrefix(r.URL.Path, path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		s.serve(s.global, w, r, next)
+	})
+}
+
+// middleware applies route limits once mux has matched a route.
+func (s *loadShedder) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				if l, ok := s.routes[template]; ok {
+					s.serve(l, w, r, next)
+					return
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *loadShedder) serve(l *concurrencyLimiter, w http.ResponseWriter, r *http.Request, next http.Handler) {
+	if reason := l.acquire(r.Context()); reason != "" {
+		s.reject(l, w, r, reason)
+		return
+	}
+
+	start := time.Now()
+	defer func() { l.release(time.Since(start)) }()
+
+	next.ServeHTTP(w, r)
+}
+
+func (s *loadShedder) reject(l *concurrencyLimiter, w http.ResponseWriter, r *http.Request, reason string) {
+	attrs := []attribute.KeyValue{
+		attribute.String("load_shed.scope", l.name),
+		attribute.String("load_shed.reason", reason),
+	}
+	trace.SpanFromContext(r.Context()).AddEvent("http.server.request.shed", trace.WithAttributes(attrs...))
+	s.shed.Add(r.Context(), 1, metric.WithAttributes(attrs...))
+
+	if s.retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(s.retryAfter.Seconds()))))
+	}
+	WriteProblem(w, NewProblem(http.StatusServiceUnavailable, "the server is overloaded, retry later"))
+}
+
+func (s *loadShedder) close() {
+	if s.registration != nil {
+		_ = s.registration.Unregister()
+	}
+}
+
+// concurrencyLimiter admits up to limit requests at once and queues a bounded
+// number of the rest in arrival order.
+type concurrencyLimiter struct {
+	name         string
+	minLimit     float64
+	maxLimit     float64
+	queueSize    int
+	queueTimeout time.Duration
+	algorithm    limitAlgorithm
+
+	mu       sync.Mutex
+	limit    float64
+	inFlight int
+	waiters  list.List
+}
+
+func newConcurrencyLimiter(name string, maxInFlight, minInFlight, queueSize int, queueTimeout time.Duration, algorithm limitAlgorithm) *concurrencyLimiter {
+	return &concurrencyLimiter{
+		name:         name,
+		minLimit:     float64(minInFlight),
+		maxLimit:     float64(maxInFlight),
+		queueSize:    queueSize,
+		queueTimeout: queueTimeout,
+		algorithm:    algorithm,
+		limit:        float64(maxInFlight),
+	}
+}
+
+// acquire takes a slot, waiting in the queue when none is free, and returns
+// why the request was shed when it could not get one.
+func (l *concurrencyLimiter) acquire(ctx context.Context) string {
+	l.mu.Lock()
+	if l.inFlight < int(l.limit) && l.waiters.Len() == 0 {
+		l.inFlight++
+		l.mu.Unlock()
+		return ""
+	}
+	if l.waiters.Len() >= l.queueSize {
+		l.mu.Unlock()
+		return "queue_full"
+	}
+	ready := make(chan struct{})
+	waiter := l.waiters.PushBack(ready)
+	l.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if l.queueTimeout > 0 {
+		timer := time.NewTimer(l.queueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	reason := ""
+	select {
+	case <-ready:
+		return ""
+	case <-timeout:
+		reason = "queue_timeout"
+	case <-ctx.Done():
+		reason = "canceled"
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	select {
+	case <-ready:
+		// the slot was granted while giving up, so use it
+		return ""
+	default:
+		l.waiters.Remove(waiter)
+		return reason
+	}
+}
+
+// release returns a slot, adjusts the limit from the request's latency and
+// hands free slots to queued requests.
+func (l *concurrencyLimiter) release(latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inFlight--
+	if l.algorithm != nil {
+		l.limit = min(max(l.algorithm.update(l.limit, latency), l.minLimit), l.maxLimit)
+	}
+
+	for l.inFlight < int(l.limit) && l.waiters.Len() > 0 {
+		ready := l.waiters.Remove(l.waiters.Front()).(chan struct{})
+		l.inFlight++
+		close(ready)
+	}
+}
+
+func (l *concurrencyLimiter) stats() (limit, inFlight int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit), l.inFlight
+}
+
+// limitAlgorithm computes a new concurrency limit from a completed request's
+// latency. It's called with the limiter's lock held.
+type limitAlgorithm interface {
+	update(limit float64, latency time.Duration) float64
+}
+
+func parseLimitAlgorithm(cfg loadShedConfig) (func() limitAlgorithm, error) {
+	switch cfg.Adaptive {
+	case "", "none":
+		return func() limitAlgorithm { return nil }, nil
+	case "aimd":
+		if cfg.LatencyTarget <= 0 {
+			return nil, errors.New("aimd needs a positive latency_target")
+		}
+		return func() limitAlgorithm { return &aimdLimit{target: cfg.LatencyTarget, backoff: 0.9} }, nil
+	case "gradient":
+		return func() limitAlgorithm { return &gradientLimit{} }, nil
+	default:
+		return nil, fmt.Errorf("unknown adaptive algorithm %q", cfg.Adaptive)
+	}
+}
+
+// aimdLimit grows the limit by one per limit's worth of requests within the
+// latency target and cuts it by the backoff ratio on every slow request.
+type aimdLimit struct {
+	target  time.Duration
+	backoff float64
+}
+
+func (a *aimdLimit) update(limit float64, latency time.Duration) float64 {
+	if latency > a.target {
+		return limit * a.backoff
+	}
+	return limit + 1/limit
+}
+
+// gradientResetSamples is how many requests the gradient's minimum latency is
+// kept for, so the baseline follows lasting changes in the workload.
+const gradientResetSamples = 1000
+
+// gradientLimit scales the limit by the ratio of the minimum observed latency
+// to the current latency, so the limit falls as queueing delay builds up and
+// grows while latency stays at its baseline.
+type gradientLimit struct {
+	minLatency time.Duration
+	samples    int
+}
+
+func (g *gradientLimit) update(limit float64, latency time.Duration) float64 {
+	if latency <= 0 {
+		return limit
+	}
+
+	g.samples++
+	if g.minLatency == 0 || latency < g.minLatency || g.samples >= gradientResetSamples {
+		g.minLatency = latency
+		g.samples = 0
+	}
+
+	gradient := min(max(float64(g.minLatency)/float64(latency), 0.5), 1)
+	target := limit*gradient + math.Sqrt(limit)
+
+	// smooth the change so a single slow request doesn't halve the limit
+	return limit*0.8 + target*0.2
+}
@@ -0,0 +1,216 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+func TestConcurrencyLimiterQueue(t *testing.T) {
+	l := newConcurrencyLimiter("test", 1, 1, 1, time.Minute, nil)
+
+	if reason := l.acquire(t.Context()); reason != "" {
+		t.Fatalf("first request was shed: %s", reason)
+	}
+
+	queued := make(chan string)
+	go func() { queued <- l.acquire(t.Context()) }()
+	waitFor(t, func() bool {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return l.waiters.Len() == 1
+	})
+
+	if reason := l.acquire(t.Context()); reason != "queue_full" {
+		t.Errorf("request over the queue size reason = %q, want queue_full", reason)
+	}
+
+	l.release(time.Millisecond)
+	if reason := <-queued; reason != "" {
+		t.Errorf("queued request was shed: %s", reason)
+	}
+	if _, inFlight := l.stats(); inFlight != 1 {
+		t.Errorf("in flight = %d, want 1", inFlight)
+	}
+}
+
+func TestConcurrencyLimiterQueueTimeout(t *testing.T) {
+	l := newConcurrencyLimiter("test", 1, 1, 1, 10*time.Millisecond, nil)
+	_ = l.acquire(t.Context())
+
+	if reason := l.acquire(t.Context()); reason != "queue_timeout" {
+		t.Errorf("reason = %q, want queue_timeout", reason)
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	if reason := l.acquire(ctx); reason != "canceled" {
+		t.Errorf("reason = %q, want canceled", reason)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.waiters.Len() != 0 {
+		t.Errorf("%d waiters left in the queue", l.waiters.Len())
+	}
+}
+
+func TestAdaptiveLimits(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		algorithm limitAlgorithm
+	}{
+		{name: "aimd", algorithm: &aimdLimit{target: 100 * time.Millisecond, backoff: 0.9}},
+		{name: "gradient", algorithm: &gradientLimit{}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			l := newConcurrencyLimiter("test", 100, 5, 0, 0, test.algorithm)
+			l.limit = 50
+
+			for range 20 {
+				_ = l.acquire(t.Context())
+				l.release(10 * time.Millisecond)
+			}
+			if l.limit <= 50 {
+				t.Errorf("limit after fast requests = %f, want above 50", l.limit)
+			}
+
+			for range 50 {
+				_ = l.acquire(t.Context())
+				l.release(time.Second)
+			}
+			if l.limit >= 50 || l.limit < 5 {
+				t.Errorf("limit after slow requests = %f, want between 5 and 50", l.limit)
+			}
+		})
+	}
+}
+
+func TestLoadShedderRoute(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	t.Cleanup(func() { _ = provider.Shutdown(t.Context()) })
+
+	shedder, err := newLoadShedder(provider.Meter("test"), loadShedConfig{
+		MaxInFlight: 10,
+		RetryAfter:  1500 * time.Millisecond,
+		Routes:      []loadShedRouteConfig{{Route: "/slow/{id}", MaxInFlight: 1}},
+	})
+	if err != nil {
+		t.Fatalf("new load shedder: %v", err)
+	}
+	t.Cleanup(shedder.close)
+
+	started, unblock := make(chan struct{}), make(chan struct{})
+	handler, recorder, _ := newTelemetryTestHandler(t, func(router *mux.Router, _ *telemetry) {
+		router.Use(shedder.middleware)
+		router.HandleFunc("/slow/{id}", func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-unblock
+		})
+	})
+	handler = shedder.handler(handler)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow/1", nil))
+	}()
+	<-started
+
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/slow/2", nil))
+	close(unblock)
+	<-done
+
+	if response.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", response.Code, http.StatusServiceUnavailable)
+	}
+	if response.Header().Get("Content-Type") != "application/problem+json" {
+		t.Errorf("content type = %q, want problem details", response.Header().Get("Content-Type"))
+	}
+	if retryAfter := response.Header().Get("Retry-After"); retryAfter != "2" {
+		t.Errorf("Retry-After = %q, want 2", retryAfter)
+	}
+	if count := int64Sum(t, reader, "http.server.request.shed", "load_shed.scope", "/slow/{id}"); count != 1 {
+		t.Errorf("shed requests = %d, want 1", count)
+	}
+
+	var events int
+	for _, span := range recorder.Ended() {
+		for _, event := range span.Events() {
+			if event.Name == "http.server.request.shed" {
+				events++
+			}
+		}
+	}
+	if events != 1 {
+		t.Errorf("shed span events = %d, want 1", events)
+	}
+}
+
+func TestLoadShedderExemptPaths(t *testing.T) {
+	shedder, err := newLoadShedder(sdkmetric.NewMeterProvider().Meter("test"), loadShedConfig{
+		MaxInFlight: 1,
+		ExemptPaths: []string{"/api/health"},
+	})
+	if err != nil {
+		t.Fatalf("new load shedder: %v", err)
+	}
+	t.Cleanup(shedder.close)
+
+	handler := shedder.handler(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	// exhaust the limit
+	if reason := shedder.global.acquire(t.Context()); reason != "" {
+		t.Fatalf("acquire: %s", reason)
+	}
+	t.Cleanup(func() { shedder.global.release(0) })
+
+	for path, want := range map[string]int{
+		"/api/health":       http.StatusNoContent,
+		"/api/health-check": http.StatusServiceUnavailable,
+		"/api/users":        http.StatusServiceUnavailable,
+	} {
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, path, nil))
+		if response.Code != want {
+			t.Errorf("%s status = %d, want %d", path, response.Code, want)
+		}
+	}
+}
+
+func TestLoadShedderInvalidConfig(t *testing.T) {
+	for name, cfg := range map[string]loadShedConfig{
+		"no limit":        {},
+		"unknown":         {MaxInFlight: 1, Adaptive: "vegas"},
+		"aimd target":     {MaxInFlight: 1, Adaptive: "aimd"},
+		"route limit":     {MaxInFlight: 1, Routes: []loadShedRouteConfig{{Route: "/"}}},
+		"duplicate route": {MaxInFlight: 1, Routes: []loadShedRouteConfig{{Route: "/", MaxInFlight: 1}, {Route: "/", MaxInFlight: 1}}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := newLoadShedder(sdkmetric.NewMeterProvider().Meter("test"), cfg); err == nil {
+				t.Error("invalid configuration was accepted")
+			}
+		})
+	}
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
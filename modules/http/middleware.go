@@ -0,0 +1,194 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/renevo/application"
+)
+
+// MiddlewarePhase is the point in handling a request where middleware runs.
+type MiddlewarePhase int
+
+const (
+	// PreRouting middleware runs for every request before a route is
+	// matched, including requests that match no route.
+	PreRouting MiddlewarePhase = iota
+	// PostRouting middleware runs once a route is matched, alongside the
+	// built in recovery, telemetry and limit middleware, before middleware
+	// registered by Routable modules.
+	PostRouting
+	// PreHandler middleware runs after all other middleware, right before
+	// the route's handler and the middleware of mounted modules.
+	PreHandler
+)
+
+func (p MiddlewarePhase) String() string {
+	switch p {
+	case PreRouting:
+		return "pre-routing"
+	case PostRouting:
+		return "post-routing"
+	case PreHandler:
+		return "pre-handler"
+	default:
+		return fmt.Sprintf("MiddlewarePhase(%d)", int(p))
+	}
+}
+
+// Middleware is a named middleware provided by a MiddlewareProvider.
+type Middleware struct {
+	// Name identifies the middleware in Before and After constraints and in
+	// logs. It must be unique within its phase.
+	Name  string
+	Phase MiddlewarePhase
+	// Before and After name the middleware of the same phase this middleware
+	// runs before or after. Names not in the phase are ignored, so
+	// constraints may refer to built in middleware that's disabled.
+	Before []string
+	After  []string
+	// Handler wraps the next handler in the chain.
+	Handler func(http.Handler) http.Handler
+}
+
+// MiddlewareProvider is implemented by application modules that provide
+// middleware. Within a phase, built in middleware runs first, then provided
+// middleware in the order the modules are routed and the order each module
+// lists it, unless Before and After constraints say otherwise.
+type MiddlewareProvider interface {
+	// Middleware returns the module's middleware during the HTTP module's
+	// Start phase. Returning an error prevents the application from
+	// starting.
+	Middleware(ctx context.Context) ([]Middleware, error)
+}
+
+// middlewareEntry is a middleware and the module it came from.
+type middlewareEntry struct {
+	Middleware
+	module  string
+	builtin bool
+}
+
+// middlewareChains returns the middleware of each phase in the order it
+// runs. Built in middleware keeps its order, provided middleware is placed
+// around it.
+func middlewareChains(ctx context.Context, modules map[string]application.Module, builtinModule string, builtin []Middleware) (map[MiddlewarePhase][]middlewareEntry, error) {
+	phases := make(map[MiddlewarePhase][]middlewareEntry)
+	for _, mw := range builtin {
+		phases[mw.Phase] = append(phases[mw.Phase], middlewareEntry{Middleware: mw, module: builtinModule, builtin: true})
+	}
+
+	for _, provider := range orderedModules(modules, func(mod application.Module) bool {
+		_, ok := mod.(MiddlewareProvider)
+		return ok
+	}) {
+		provided, err := provider.module.(MiddlewareProvider).Middleware(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get middleware for module %q: %w", provider.name, err)
+		}
+		for _, mw := range provided {
+			if mw.Name == "" || mw.Handler == nil {
+				return nil, fmt.Errorf("middleware of module %q needs a name and a handler", provider.name)
+			}
+			if mw.Phase < PreRouting || mw.Phase > PreHandler {
+				return nil, fmt.Errorf("middleware %q of module %q has unknown phase %d", mw.Name, provider.name, mw.Phase)
+			}
+			phases[mw.Phase] = append(phases[mw.Phase], middlewareEntry{Middleware: mw, module: provider.name})
+		}
+	}
+
+	for phase, entries := range phases {
+		sorted, err := sortMiddleware(entries)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s middleware: %w", phase, err)
+		}
+		phases[phase] = sorted
+	}
+	return phases, nil
+}
+
+// sortMiddleware orders entries by their constraints. Entries without
+// constraints between them keep their order.
+func sortMiddleware(entries []middlewareEntry) ([]middlewareEntry, error) {
+	index := make(map[string]int, len(entries))
+	for i, e := range entries {
+		if _, exists := index[e.Name]; exists {
+			return nil, fmt.Errorf("middleware %q is registered more than once", e.Name)
+		}
+		index[e.Name] = i
+	}
+
+	// edges run from the middleware that runs first
+	next := make([][]int, len(entries))
+	incoming := make([]int, len(entries))
+	edge := func(from, to int) {
+		next[from] = append(next[from], to)
+		incoming[to]++
+	}
+
+	previous := -1
+	for i, e := range entries {
+		if e.builtin {
+			if previous >= 0 {
+				edge(previous, i)
+			}
+			previous = i
+		}
+		for _, name := range e.Before {
+			if j, ok := index[name]; ok {
+				edge(i, j)
+			}
+		}
+		for _, name := range e.After {
+			if j, ok := index[name]; ok {
+				edge(j, i)
+			}
+		}
+	}
+
+	// the earliest registered middleware that's ready runs next
+	var ready []int
+	for i := range entries {
+		if incoming[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+
+	sorted := make([]middlewareEntry, 0, len(entries))
+	for len(ready) > 0 {
+		slices.Sort(ready)
+		i := ready[0]
+		ready = ready[1:]
+		sorted = append(sorted, entries[i])
+
+		for _, j := range next[i] {
+			incoming[j]--
+			if incoming[j] == 0 {
+				ready = append(ready, j)
+			}
+		}
+	}
+
+	if len(sorted) != len(entries) {
+		var cycle []string
+		for i, e := range entries {
+			if incoming[i] > 0 {
+				cycle = append(cycle, e.Name)
+			}
+		}
+		return nil, fmt.Errorf("before and after constraints form a cycle between %s", strings.Join(cycle, ", "))
+	}
+	return sorted, nil
+}
+
+// middlewareNames returns the names of the middleware in chain, in order.
+func middlewareNames(chain []middlewareEntry) []string {
+	names := make([]string, 0, len(chain))
+	for _, mw := range chain {
+		names = append(names, mw.Name)
+	}
+	return names
+}
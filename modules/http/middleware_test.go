@@ -0,0 +1,110 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/renevo/application"
+)
+
+type testMiddlewareProvider struct {
+	testRoutable
+	middleware []Middleware
+}
+
+func (m *testMiddlewareProvider) Middleware(context.Context) ([]Middleware, error) {
+	return m.middleware, nil
+}
+
+func TestMiddlewareChains(t *testing.T) {
+	noop := func(next http.Handler) http.Handler { return next }
+	mw := func(name string, phase MiddlewarePhase, before, after []string) Middleware {
+		return Middleware{Name: name, Phase: phase, Before: before, After: after, Handler: noop}
+	}
+	builtin := []Middleware{
+		mw("request_id", PreRouting, nil, nil),
+		mw("security_headers", PreRouting, nil, nil),
+		mw("compression", PreRouting, nil, nil),
+		mw("recovery", PostRouting, nil, nil),
+		mw("telemetry", PostRouting, nil, nil),
+	}
+
+	for _, test := range []struct {
+		name    string
+		modules map[string][]Middleware
+		want    map[MiddlewarePhase][]string
+		err     string
+	}{
+		{
+			name: "appended",
+			modules: map[string][]Middleware{
+				"zeta":  {mw("audit", PostRouting, nil, nil)},
+				"alpha": {mw("auth", PostRouting, nil, nil), mw("tenant", PreHandler, nil, nil)},
+			},
+			want: map[MiddlewarePhase][]string{
+				PreRouting:  {"request_id", "security_headers", "compression"},
+				PostRouting: {"recovery", "telemetry", "auth", "audit"},
+				PreHandler:  {"tenant"},
+			},
+		},
+		{
+			name: "constrained",
+			modules: map[string][]Middleware{
+				"alpha": {
+					mw("auth", PostRouting, []string{"telemetry"}, []string{"recovery"}),
+					mw("etag", PreRouting, []string{"compression"}, nil),
+					mw("ignored", PreRouting, []string{"cors"}, nil),
+				},
+				"zeta": {mw("session", PostRouting, []string{"auth"}, nil)},
+			},
+			want: map[MiddlewarePhase][]string{
+				PreRouting:  {"request_id", "security_headers", "etag", "compression", "ignored"},
+				PostRouting: {"recovery", "session", "auth", "telemetry"},
+			},
+		},
+		{
+			name:    "builtin order",
+			modules: map[string][]Middleware{"alpha": {mw("auth", PostRouting, []string{"recovery"}, []string{"telemetry"})}},
+			err:     "cycle between recovery, telemetry, auth",
+		},
+		{
+			name: "duplicate",
+			modules: map[string][]Middleware{
+				"alpha": {mw("auth", PostRouting, nil, nil)},
+				"zeta":  {mw("auth", PostRouting, nil, nil)},
+			},
+			err: `middleware "auth" is registered more than once`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			modules := make(map[string]application.Module)
+			for name, middleware := range test.modules {
+				modules[name] = &testMiddlewareProvider{middleware: middleware}
+			}
+
+			chains, err := middlewareChains(t.Context(), modules, "HTTP", builtin)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("error = %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, phase := range []MiddlewarePhase{PreRouting, PostRouting, PreHandler} {
+				var names []string
+				for _, e := range chains[phase] {
+					names = append(names, e.Name)
+				}
+				if !slices.Equal(names, test.want[phase]) {
+					t.Errorf("%s middleware = %v, want %v", phase, names, test.want[phase])
+				}
+			}
+		})
+	}
+}
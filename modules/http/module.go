@@ -4,28 +4,43 @@
 package http
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
-	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/renevo/application"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"golang.org/x/crypto/acme/autocert"
 )
 
 type module struct {
-	cfg      *cfg
-	content  http.FileSystem
-	listener net.Listener
-	server   *http.Server
+	cfg             *cfg
+	content         http.FileSystem
+	listener        net.Listener
+	server          *http.Server
+	acme            *autocert.Manager
+	certs           certificates
+	challengeServer *http.Server
+	conns           *connections
+	shedder         *loadShedder
+	rateLimiter     *rateLimiter
+	routes          []routeInfo
+
+	routeTable       io.Writer
+	routeTableFormat string
+	openAPI          []byte
 }
 
 type cfg struct {
@@ -40,6 +55,46 @@ type httpConfig struct {
 	ShutdownTimeout time.Duration `setting:"shutdown_timeout" description:"The maximum duration for shutting down the server gracefully"`
 	CertificateFile string        `setting:"cert_file" description:"File location for the ssl certificate file"`
 	KeyFile         string        `setting:"key_file" description:"File location for the ssl certificate key file"`
+
+	ReadHeaderTimeout   time.Duration `setting:"read_header_timeout" description:"The maximum duration for reading the request headers"`
+	MaxHeaderBytes      int           `setting:"max_header_bytes" description:"The maximum size of the request headers in bytes"`
+	MaxBodySize         int64         `setting:"max_body_size" description:"The maximum size of request bodies in bytes, zero is unlimited"`
+	RequestTimeout      time.Duration `setting:"request_timeout" description:"The maximum duration handlers have to respond, zero is unlimited"`
+	MaxConnections      int           `setting:"max_connections" description:"The maximum number of concurrent connections, zero is unlimited"`
+	MaxConnectionsPerIP int           `setting:"max_connections_per_ip" description:"The maximum number of concurrent connections from a single address, zero is unlimited"`
+
+	CertificateReloadInterval time.Duration `setting:"cert_reload_interval" description:"How often the certificate files are checked for changes, zero disables reloading"`
+	CertificateExpiryWarning  time.Duration `setting:"cert_expiry_warning" description:"How long before the certificate expires the health check reports a warning"`
+
+	ClientCAFile    string   `setting:"client_ca_file" description:"File location for the CA certificates that client certificates are verified against"`
+	ClientAuth      string   `setting:"client_auth" description:"The client certificate policy: none, request, require or verify"`
+	ClientAuthPaths []string `setting:"client_auth_paths" description:"Path prefixes that require a verified client certificate"`
+
+	RoutesPath string `setting:"routes_path" description:"The path of the endpoint listing the route table, empty disables it"`
+
+	ServerHeader string `setting:"server_header" description:"The Server response header, {name} and {version} are replaced with the application's, empty leaves the header out"`
+
+	TrustedProxies  []string `setting:"trusted_proxies" description:"The proxy address ranges whose forwarding headers are trusted"`
+	ForwardedHeader string   `setting:"forwarded_header" description:"The forwarding header trusted proxies set the client address in: X-Forwarded-For, Forwarded or X-Real-IP"`
+	ProxyHops       int      `setting:"proxy_hops" description:"The number of proxies in front of the server, when set the client address is taken that many hops from the right instead of skipping trusted proxies"`
+
+	H2C           h2cConfig             `config:"h2c,block"`
+	ProxyProtocol proxyProtocolConfig   `config:"proxy_protocol,block"`
+	LoadShed      loadShedConfig        `config:"load_shed,block"`
+	RateLimit     rateLimitConfig       `config:"rate_limit,block"`
+	CORS          corsConfig            `config:"cors,block"`
+	Security      securityHeadersConfig `config:"security_headers,block"`
+	Compression   compressionConfig     `config:"compression,block"`
+	RequestID     requestIDConfig       `config:"request_id,block"`
+	BodyLimits    []bodyLimitConfig     `config:"body_limit,block"`
+	RouteTimeouts []routeTimeoutConfig  `config:"route_timeout,block"`
+	Mounts        []mountConfig         `config:"mount,block"`
+	OpenAPI       openAPIConfig         `config:"openapi,block"`
+	Recovery      recoveryConfig        `config:"recovery,block"`
+	ErrorPages    errorPagesConfig      `config:"error_pages,block"`
+	TLS           tlsConfig             `config:"tls,block"`
+	ACME          acmeConfig            `config:"acme,block"`
+	DevTLS        devTLSConfig          `config:"dev_tls,block"`
 }
 
 var (
@@ -49,9 +104,22 @@ var (
 	_ application.Initializer = (*module)(nil)
 )
 
+// Option configures an HTTP server module.
+type Option func(*module)
+
+// WithRouteTable makes the module write its route table to w, as text or
+// json, once every module is routed, and exit the application instead of
+// serving.
+func WithRouteTable(w io.Writer, format string) Option {
+	return func(m *module) {
+		m.routeTable = w
+		m.routeTableFormat = format
+	}
+}
+
 // New returns an HTTP server module. When content is non-nil, the module serves
 // it from the root path after routes registered by Routable modules.
-func New(content http.FileSystem) application.Module {
+func New(content http.FileSystem, opts ...Option) application.Module {
 	m := &module{
 		content: content,
 		cfg: &cfg{
@@ -61,10 +129,80 @@ func New(content http.FileSystem) application.Module {
 				ReadTimeout:     5 * time.Second,
 				WriteTimeout:    10 * time.Second,
 				ShutdownTimeout: 30 * time.Second,
+
+				ReadHeaderTimeout: 2 * time.Second,
+				MaxHeaderBytes:    http.DefaultMaxHeaderBytes,
+				MaxBodySize:       10 << 20,
+
+				CertificateReloadInterval: time.Minute,
+				CertificateExpiryWarning:  14 * 24 * time.Hour,
+
+				ClientAuth: "none",
+
+				ServerHeader: "{name}/{version}",
+
+				TrustedProxies:  defaultTrustedProxies,
+				ForwardedHeader: "X-Forwarded-For",
+
+				TLS: tlsConfig{
+					MinVersion: "1.2",
+				},
+				ProxyProtocol: proxyProtocolConfig{
+					HeaderTimeout: 5 * time.Second,
+				},
+				LoadShed: loadShedConfig{
+					MaxInFlight:   1000,
+					MinInFlight:   10,
+					QueueSize:     100,
+					QueueTimeout:  time.Second,
+					RetryAfter:    time.Second,
+					Adaptive:      "none",
+					LatencyTarget: time.Second,
+					ExemptPaths:   []string{"/api/health"},
+				},
+				RateLimit: rateLimitConfig{
+					Store: "memory",
+				},
+				Compression: compressionConfig{
+					Enabled:                    true,
+					Encodings:                  []string{"zstd", "gzip"},
+					Level:                      "default",
+					MinSize:                    1024,
+					ContentTypes:               defaultCompressibleTypes,
+					DecompressRequests:         true,
+					MaxDecompressedRequestSize: 10 << 20,
+				},
+				OpenAPI: openAPIConfig{
+					Path:        "/openapi.json",
+					UIAssetsURL: "https://unpkg.com/swagger-ui-dist@5.17.14",
+				},
+				Recovery: recoveryConfig{
+					Title:  "Internal Server Error",
+					Detail: "The server encountered an unexpected error.",
+				},
+				ErrorPages: errorPagesConfig{
+					Templates: "errors",
+				},
+				RequestID: requestIDConfig{
+					Enabled:       true,
+					TrustIncoming: true,
+				},
+				Security: securityHeadersConfig{
+					Enabled:               true,
+					HSTSMaxAge:            365 * 24 * time.Hour,
+					HSTSIncludeSubdomains: true,
+					ContentTypeOptions:    "nosniff",
+					ReferrerPolicy:        "strict-origin-when-cross-origin",
+					PermissionsPolicy:     "camera=(), microphone=(), geolocation=()",
+				},
 			},
 		},
 	}
 
+	for _, opt := range opts {
+		opt(m)
+	}
+
 	return m
 }
 
@@ -80,35 +218,180 @@ func (m *module) Start(ctx *application.Context) error {
 	router := mux.NewRouter()
 	telemetry := newTelemetry()
 
+	trustedProxies, err := parsePrefixes(m.cfg.HTTP.TrustedProxies)
+	if err != nil {
+		return fmt.Errorf("invalid http.trusted_proxies: %w", err)
+	}
+	forwardedHeader, err := parseForwardedHeader(m.cfg.HTTP.ForwardedHeader)
+	if err != nil {
+		return fmt.Errorf("invalid http.forwarded_header: %w", err)
+	}
+	if m.cfg.HTTP.ProxyHops < 0 {
+		return errors.New("http.proxy_hops must not be negative")
+	}
+
+	// connections come from the load balancer with the PROXY protocol, so a
+	// per address limit would be shared by all of its clients
+	if m.cfg.HTTP.ProxyProtocol.Enabled && m.cfg.HTTP.MaxConnectionsPerIP > 0 {
+		return errors.New("http.max_connections_per_ip cannot be used with http.proxy_protocol")
+	}
+
+	// the header is read before the server's own timeouts apply, so without a
+	// deadline a silent upstream connection is held forever
+	if m.cfg.HTTP.ProxyProtocol.Enabled && m.cfg.HTTP.ProxyProtocol.HeaderTimeout <= 0 {
+		return errors.New("http.proxy_protocol.header_timeout must be positive")
+	}
+
+	meter := otel.Meter("github.com/renevo/bootstrap/modules/http")
+	m.conns, err = newConnections(meter, m.cfg.HTTP.MaxConnections, m.cfg.HTTP.MaxConnectionsPerIP)
+	if err != nil {
+		return err
+	}
+
+	// built in middleware in the order it runs
+	var builtin []Middleware
+
+	// the ID is set outermost so every response and log carries it
+	if m.cfg.HTTP.RequestID.Enabled {
+		builtin = append(builtin, Middleware{Name: "request_id", Phase: PreRouting, Handler: newRequestIDs(m.cfg.HTTP.RequestID).handler})
+	}
+
+	// security headers are set on every response, including those answered
+	// before routing. HSTS from a development certificate would pin the host
+	// to HTTPS in the developer's browser.
+	security := m.cfg.HTTP.Security
+	if m.cfg.HTTP.DevTLS.Enabled {
+		security.HSTSMaxAge = 0
+	}
+	builtin = append(builtin, Middleware{
+		Name:    "security_headers",
+		Phase:   PreRouting,
+		Handler: newSecurityHeaders(security, serverHeader(m.cfg.HTTP.ServerHeader, serverName, serverVersion)).handler,
+	})
+
+	// client certificates are enforced once the rejection can be logged and
+	// carry the request ID and security headers
+	if len(m.cfg.HTTP.ClientAuthPaths) > 0 {
+		builtin = append(builtin, Middleware{Name: "client_auth", Phase: PreRouting, Handler: clientAuthPaths(m.cfg.HTTP.ClientAuthPaths)})
+	}
+
+	// preflight requests are answered before routing and load shedding
+	if m.cfg.HTTP.CORS.Enabled {
+		cors, err := newCORS(m.cfg.HTTP.CORS)
+		if err != nil {
+			return fmt.Errorf("invalid http.cors: %w", err)
+		}
+		builtin = append(builtin, Middleware{Name: "cors", Phase: PreRouting, Handler: cors.handler})
+	}
+
+	if m.cfg.HTTP.Compression.Enabled || m.cfg.HTTP.Compression.DecompressRequests {
+		compression, err := newCompression(m.cfg.HTTP.Compression)
+		if err != nil {
+			return fmt.Errorf("invalid http.compression: %w", err)
+		}
+		builtin = append(builtin, Middleware{Name: "compression", Phase: PreRouting, Handler: compression.handler})
+	}
+
+	// requests over the server wide limit are shed before routing
+	if m.cfg.HTTP.LoadShed.Enabled {
+		m.shedder, err = newLoadShedder(meter, m.cfg.HTTP.LoadShed)
+		if err != nil {
+			return fmt.Errorf("invalid http.load_shed: %w", err)
+		}
+		builtin = append(builtin, Middleware{Name: "load_shed", Phase: PreRouting, Handler: m.shedder.handler})
+	}
+
+	bodyLimits, err := newBodyLimits(meter, m.cfg.HTTP.MaxBodySize, m.cfg.HTTP.BodyLimits)
+	if err != nil {
+		return fmt.Errorf("invalid http.body_limit: %w", err)
+	}
+
+	timeouts, err := newTimeouts(meter, m.cfg.HTTP.RequestTimeout, m.cfg.HTTP.RouteTimeouts)
+	if err != nil {
+		return fmt.Errorf("invalid http.route_timeout: %w", err)
+	}
+
+	if m.cfg.HTTP.RateLimit.Enabled {
+		m.rateLimiter, err = newRateLimiter(ctx, m.cfg.HTTP.RateLimit)
+		if err != nil {
+			return fmt.Errorf("invalid http.rate_limit: %w", err)
+		}
+	}
+
+	recovery, err := newRecovery(meter, m.cfg.HTTP.Recovery)
+	if err != nil {
+		return err
+	}
+
+	// Route telemetry runs after mux selects a route and before application
+	// middleware, while the outer otelhttp handler captures every response.
+	builtin = append(builtin,
+		Middleware{Name: "recovery", Phase: PostRouting, Handler: recovery.middleware},
+		Middleware{Name: "telemetry", Phase: PostRouting, Handler: telemetry.middleware},
+		Middleware{Name: "body_limit", Phase: PostRouting, Handler: bodyLimits.middleware},
+		Middleware{Name: "timeout", Phase: PostRouting, Handler: timeouts.middleware},
+	)
+
+	// route limits need the matched route template, rate limits come first so
+	// rejected clients don't hold load shedding slots
+	if m.rateLimiter != nil {
+		builtin = append(builtin, Middleware{Name: "rate_limit", Phase: PostRouting, Handler: m.rateLimiter.middleware})
+	}
+	if m.shedder != nil {
+		builtin = append(builtin, Middleware{Name: "load_shed", Phase: PostRouting, Handler: m.shedder.middleware})
+	}
+
+	// the module's own routes and middleware are owned by the name it was
+	// registered under
+	moduleName := "HTTP"
+	for name, mod := range app.Modules() {
+		if mod == application.Module(m) {
+			moduleName = name
+		}
+	}
+
+	chains, err := middlewareChains(ctx, app.Modules(), moduleName, builtin)
+	if err != nil {
+		return err
+	}
+	for _, phase := range []MiddlewarePhase{PreRouting, PostRouting, PreHandler} {
+		for i, mw := range chains[phase] {
+			ctx.Logger().DebugContext(ctx, "HTTP Middleware", "phase", phase.String(), "order", i+1, "name", mw.Name, "module", mw.module)
+		}
+	}
+
+	handler := http.Handler(router)
+	for _, mw := range slices.Backward(chains[PreRouting]) {
+		handler = mw.Handler(handler)
+	}
+
 	// setup http server
 	m.server = &http.Server{
 		ReadTimeout:  m.cfg.HTTP.ReadTimeout,
 		WriteTimeout: m.cfg.HTTP.WriteTimeout,
 		IdleTimeout:  m.cfg.HTTP.IdleTimeout,
+
+		ReadHeaderTimeout: m.cfg.HTTP.ReadHeaderTimeout,
+		MaxHeaderBytes:    m.cfg.HTTP.MaxHeaderBytes,
+		ConnState:         m.conns.trackState,
+
 		BaseContext: func(net.Listener) context.Context {
 			return ctx
 		},
-		Handler: handlers.CombinedLoggingHandler(os.Stderr, handlers.ProxyHeaders(
-			otelhttp.NewHandler(telemetry.handler(router), app.Name(), otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+		Handler: clientIdentityHandler(forwardedHandler(trustedProxies, forwardedHeader, m.cfg.HTTP.ProxyHops, accessLogHandler(os.Stderr, m.cfg.HTTP.RequestID.Enabled,
+			otelhttp.NewHandler(telemetry.handler(handler), app.Name(), otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
 				return r.Method
 			})),
-		)),
+		))),
 	}
 
-	// panic handling
-	router.Use(handlers.RecoveryHandler(handlers.PrintRecoveryStack(true)))
+	table := newRouteTable()
+	table.use(router, middlewareNames(chains[PreRouting])...)
 
-	// default headers
-	router.Use(func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Server", fmt.Sprintf("%s/%s", serverName, serverVersion))
-			next.ServeHTTP(w, r)
-		})
-	})
-
-	// Route telemetry runs after mux selects a route and before application
-	// middleware, while the outer otelhttp handler captures every response.
-	router.Use(telemetry.middleware)
+	for _, mw := range chains[PostRouting] {
+		router.Use(mw.Handler)
+	}
+	table.use(router, middlewareNames(chains[PostRouting])...)
 
 	// TODO: These routes might need to be protected on specific addresses/ranges only
 	// for now, they are open to the world, which might not be a great idea
@@ -117,33 +400,108 @@ func (m *module) Start(ctx *application.Context) error {
 	router.Handle("/metrics", promhttp.Handler())
 
 	// health check endpoint
-	router.HandleFunc("/api/health", func(w http.ResponseWriter, r *http.Request) {
-		_ = json.NewEncoder(w).Encode(map[string]bool{"ok": true})
-	})
+	router.Handle("/api/health", Handle(Operation{Summary: "Report the server health", Tags: []string{"health"}}, func(context.Context, struct{}) (healthResponse, error) {
+		return healthResponse{OK: true, Warnings: m.healthWarnings()}, nil
+	}))
+
+	// route table endpoint, JSON unless text is asked for
+	if m.cfg.HTTP.RoutesPath != "" {
+		router.HandleFunc(m.cfg.HTTP.RoutesPath, func(w http.ResponseWriter, r *http.Request) {
+			format := r.URL.Query().Get("format")
+			if format == "" {
+				format = "json"
+			}
+			if format == "json" {
+				w.Header().Set("Content-Type", "application/json")
+			} else {
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			}
+			if err := writeRoutes(w, m.routes, format); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			}
+		}).Methods(http.MethodGet)
+	}
+
+	// OpenAPI document, generated once every module is routed
+	var openAPIRoutes []*mux.Route
+	openAPICfg := m.cfg.HTTP.OpenAPI
+	if openAPICfg.Enabled {
+		openAPICfg.Title = cmp.Or(openAPICfg.Title, serverName)
+		openAPICfg.Version = cmp.Or(openAPICfg.Version, serverVersion)
+
+		openAPIRoutes = append(openAPIRoutes, router.HandleFunc(openAPICfg.Path, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write(m.openAPI)
+		}).Methods(http.MethodGet))
+
+		if openAPICfg.UIPath != "" {
+			if openAPICfg.UIScriptIntegrity == "" || openAPICfg.UIStyleIntegrity == "" {
+				ctx.Logger().Warn("Swagger UI assets are loaded without integrity checks, set http.openapi.ui_script_integrity and http.openapi.ui_style_integrity", "url", openAPICfg.UIAssetsURL)
+			}
+			openAPIRoutes = append(openAPIRoutes, router.Handle(openAPICfg.UIPath, openAPIUIHandler(openAPICfg)).Methods(http.MethodGet))
+		}
+	}
 
 	// route registrations from other modules
-	var registrationErr error
+	table.claim(router, moduleName)
 
-	for name, mod := range app.Modules() {
-		routable, ok := mod.(Routable)
-		if !ok {
-			continue
-		}
+	ordered := routables(app.Modules())
+	mounts, err := parseMounts(m.cfg.HTTP.Mounts, ordered)
+	if err != nil {
+		return fmt.Errorf("invalid http.mount: %w", err)
+	}
 
-		if err := routable.Route(ctx, router); err != nil {
-			registrationErr = fmt.Errorf("failed to route for module %q: %w", name, err)
-			break
+	for _, r := range ordered {
+		if err := r.route(ctx, router, mounts[r.name]); err != nil {
+			return fmt.Errorf("failed to route for module %q: %w", r.name, err)
 		}
+		table.claim(router, r.name)
 	}
 
-	if registrationErr != nil {
-		return registrationErr
+	// registered after the middleware of Routable modules, so it runs last
+	for _, mw := range chains[PreHandler] {
+		router.Use(mw.Handler)
+	}
+	table.use(router, middlewareNames(chains[PreHandler])...)
+
+	// error responses, unless a module set its own
+	pages, err := newErrorPages(m.content, m.cfg.HTTP.ErrorPages.Templates)
+	if err != nil {
+		return fmt.Errorf("invalid http.error_pages: %w", err)
+	}
+	if router.NotFoundHandler == nil {
+		router.NotFoundHandler = pages.handler(http.StatusNotFound)
+	}
+	if router.MethodNotAllowedHandler == nil {
+		router.MethodNotAllowedHandler = pages.handler(http.StatusMethodNotAllowed)
 	}
 
 	// static file hosting
 	if m.content != nil {
-		telemetry.staticRoute = router.PathPrefix("/").Handler(http.FileServer(m.content)).Methods(http.MethodGet, http.MethodHead)
+		telemetry.staticRoute = router.PathPrefix("/").Handler(pages.fileServer(m.content)).Methods(http.MethodGet, http.MethodHead)
+		table.claim(router, moduleName)
 	}
+
+	m.routes, err = table.build(router)
+	if err != nil {
+		return err
+	}
+	telemetry.modules = table.owners
+
+	if openAPICfg.Enabled {
+		document, err := openAPIDocument(router, openAPICfg, openAPIRoutes...)
+		if err != nil {
+			return fmt.Errorf("failed to generate OpenAPI document: %w", err)
+		}
+		if m.openAPI, err = json.Marshal(document); err != nil {
+			return fmt.Errorf("failed to encode OpenAPI document: %w", err)
+		}
+	}
+
+	for _, route := range m.routes {
+		ctx.Logger().DebugContext(ctx, "HTTP Route", "module", route.Module, "route", route.String(), "name", route.Name)
+	}
+
 	if err := telemetry.configureFallbackHandlers(router); err != nil {
 		return fmt.Errorf("failed to configure HTTP telemetry: %w", err)
 	}
@@ -153,6 +511,33 @@ func (m *module) Start(ctx *application.Context) error {
 
 func (m *module) PostStart(ctx *application.Context) error {
 	logger := ctx.Logger()
+
+	if m.routeTable != nil {
+		if err := writeRoutes(m.routeTable, m.routes, m.routeTableFormat); err != nil {
+			return err
+		}
+
+		// exit once the application has finished starting, without serving
+		if app := application.FromContext(ctx); app != nil {
+			go func() { _ = app.Exit(nil) }()
+		}
+		return nil
+	}
+
+	isHTTPS, err := m.configureTLS(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to configure TLS: %w", err)
+	}
+
+	if m.cfg.HTTP.H2C.Enabled {
+		if isHTTPS {
+			return errors.New("http.h2c cannot be enabled with TLS, HTTP/2 over TLS is negotiated automatically")
+		}
+		if err := m.configureH2C(); err != nil {
+			return fmt.Errorf("failed to configure h2c: %w", err)
+		}
+	}
+
 	// listener
 	// TODO: support unix://
 	listener, err := net.Listen("tcp", m.cfg.HTTP.Addr)
@@ -166,7 +551,22 @@ func (m *module) PostStart(ctx *application.Context) error {
 		m.listener = listener
 	}
 
-	isHTTPS := m.cfg.HTTP.CertificateFile != "" && m.cfg.HTTP.KeyFile != ""
+	// the connection limit counts connections from the load balancer too when
+	// the PROXY protocol is in use
+	m.listener = m.conns.listener(m.listener)
+
+	if proxyCfg := m.cfg.HTTP.ProxyProtocol; proxyCfg.Enabled {
+		trusted, err := parsePrefixes(proxyCfg.TrustedCIDRs)
+		if err == nil && len(trusted) == 0 {
+			err = errors.New("no trusted_cidrs configured")
+		}
+		if err != nil {
+			_ = m.listener.Close()
+			return fmt.Errorf("invalid http.proxy_protocol.trusted_cidrs: %w", err)
+		}
+
+		m.listener = &proxyProtocolListener{Listener: m.listener, trusted: trusted, timeout: proxyCfg.HeaderTimeout}
+	}
 
 	if isHTTPS {
 		logger.Info("HTTPS Server Listening", "url", fmt.Sprintf("https://%s", m.listener.Addr().String()))
@@ -174,39 +574,65 @@ func (m *module) PostStart(ctx *application.Context) error {
 		logger.Info("HTTP Server Listening", "url", fmt.Sprintf("http://%s", m.listener.Addr().String()))
 	}
 
-	go func() {
-		var err error
-		if isHTTPS {
-			// TODO: eventually we want to support ACME as well as app loaded certificates like this, let's call this a v0 implementation
-			// https://pkg.go.dev/golang.org/x/crypto/acme/autocert
-			err = m.server.ServeTLS(m.listener, m.cfg.HTTP.CertificateFile, m.cfg.HTTP.KeyFile)
-		} else {
-			err = m.server.Serve(m.listener)
-		}
-
-		// don't panic on server closed
-		if err != nil && !errors.Is(err, http.ErrServerClosed) {
-			// don't panic on not being able to accept connections (dirty/hacky/works)
-			var nopErr *net.OpError
-			if errors.As(err, &nopErr) && (strings.EqualFold(nopErr.Op, "accept") && strings.Contains(nopErr.Error(), "closed network connection")) {
-				return
-			}
+	// ACME HTTP-01 challenges, other requests are redirected to HTTPS
+	if m.acme != nil && m.cfg.HTTP.ACME.ChallengeAddress != "" {
+		challengeListener, err := net.Listen("tcp", m.cfg.HTTP.ACME.ChallengeAddress)
+		if err != nil {
+			_ = m.listener.Close()
+			return fmt.Errorf("failed to listen on %q: %w", m.cfg.HTTP.ACME.ChallengeAddress, err)
+		}
 
-			app := application.FromContext(ctx)
-			if app != nil {
-				_ = app.Exit(fmt.Errorf("http server failed to serve: %w", err))
-				return
-			}
+		m.challengeServer = &http.Server{
+			Handler:           m.acme.HTTPHandler(nil),
+			ReadTimeout:       m.cfg.HTTP.ReadTimeout,
+			ReadHeaderTimeout: m.cfg.HTTP.ReadHeaderTimeout,
+			MaxHeaderBytes:    m.cfg.HTTP.MaxHeaderBytes,
+		}
 
-			// can't gracefully shutdown, so just die
-			logger.Error("HTTP Serve Failure", "err", err)
-			os.Exit(1)
+		logger.Info("ACME Challenge Server Listening", "url", fmt.Sprintf("http://%s", challengeListener.Addr().String()))
+		go m.serve(ctx, "acme challenge", func() error {
+			return m.challengeServer.Serve(challengeListener)
+		})
+	}
+
+	go m.serve(ctx, "http", func() error {
+		if isHTTPS {
+			// certificates are supplied by the server TLS configuration
+			return m.server.ServeTLS(m.listener, "", "")
 		}
-	}()
+		return m.server.Serve(m.listener)
+	})
 
 	return nil
 }
 
+// serve runs a blocking serve function and exits the application when it fails
+// for any reason other than a shutdown.
+func (m *module) serve(ctx *application.Context, name string, serve func() error) {
+	err := serve()
+
+	// don't panic on server closed
+	if err == nil || errors.Is(err, http.ErrServerClosed) {
+		return
+	}
+
+	// don't panic on not being able to accept connections (dirty/hacky/works)
+	var nopErr *net.OpError
+	if errors.As(err, &nopErr) && (strings.EqualFold(nopErr.Op, "accept") && strings.Contains(nopErr.Error(), "closed network connection")) {
+		return
+	}
+
+	app := application.FromContext(ctx)
+	if app != nil {
+		_ = app.Exit(fmt.Errorf("%s server failed to serve: %w", name, err))
+		return
+	}
+
+	// can't gracefully shutdown, so just die
+	ctx.Logger().Error("HTTP Serve Failure", "server", name, "err", err)
+	os.Exit(1)
+}
+
 func (m *module) PreStop(ctx *application.Context) error {
 	logger := ctx.Logger()
 	logger.InfoContext(ctx, "Stopping HTTP Server")
@@ -230,26 +656,40 @@ func (m *module) PreStop(ctx *application.Context) error {
 		m.server = nil
 	}
 
-	return nil
-}
+	if m.challengeServer != nil {
+		_ = m.challengeServer.Close()
+		m.challengeServer = nil
+	}
+
+	if m.certs != nil {
+		m.certs.close()
+		m.certs = nil
+	}
+
+	if m.shedder != nil {
+		m.shedder.close()
+		m.shedder = nil
+	}
 
-func (m *module) Stop(ctx *application.Context) error {
 	return nil
 }
 
-// tcpKeepAliveListener sets TCP keep-alive timeouts on accepted connections. It's used so dead TCP connections (e.g. closing laptop mid-download) eventually go away.
-type tcpKeepAliveListener struct {
-	*net.TCPListener
+// healthResponse is the body of the health check endpoint.
+type healthResponse struct {
+	OK       bool     `json:"ok"`
+	Warnings []string `json:"warnings,omitempty" description:"Conditions that need attention"`
 }
 
-func (ln tcpKeepAliveListener) Accept() (net.Conn, error) {
-	tc, err := ln.AcceptTCP()
-	if err != nil {
-		return nil, err
-	}
+// healthWarnings returns conditions that do not fail the health check but need
+// attention.
+func (m *module) healthWarnings() []string {
+	var warnings []string
 
-	_ = tc.SetKeepAlive(true)
-	_ = tc.SetKeepAlivePeriod(3 * time.Minute)
+	warnings = append(warnings, m.certs.expiryWarnings(m.cfg.HTTP.CertificateExpiryWarning)...)
 
-	return tc, nil
+	return warnings
+}
+
+func (m *module) Stop(ctx *application.Context) error {
+	return nil
 }
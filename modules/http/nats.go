@@ -0,0 +1,18 @@
+package http
+
+import (
+	"context"
+
+	"github.com/nats-io/nats.go"
+	"github.com/renevo/ioc"
+)
+
+// natsConn returns the connection the NATS module registers in the IoC
+// container, or nil when it isn't connected.
+func natsConn(ctx context.Context) *nats.Conn {
+	nc, err := ioc.ResolveFromContext[*nats.Conn](ctx)
+	if err != nil {
+		return nil
+	}
+	return nc
+}
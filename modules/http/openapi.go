@@ -0,0 +1,420 @@
+package http
+
+import (
+	_ "embed"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type openAPIConfig struct {
+	Enabled           bool   `setting:"enabled" description:"Serve an OpenAPI 3 document generated from the registered routes"`
+	Path              string `setting:"path" description:"The path the OpenAPI document is served from"`
+	Title             string `setting:"title" description:"The API title, defaults to the application name"`
+	Version           string `setting:"version" description:"The API version, defaults to the application version"`
+	Description       string `setting:"description" description:"The API description"`
+	UIPath            string `setting:"ui_path" description:"The path of an interactive documentation page for the document, empty disables it"`
+	UIAssetsURL       string `setting:"ui_assets_url" description:"The base URL the documentation page loads Swagger UI from, pinned to an exact version"`
+	UIScriptIntegrity string `setting:"ui_script_integrity" description:"The subresource integrity hash of swagger-ui-bundle.js, such as sha384-..."`
+	UIStyleIntegrity  string `setting:"ui_style_integrity" description:"The subresource integrity hash of swagger-ui.css, such as sha384-..."`
+}
+
+//go:embed openapi.html
+var openAPIUISource string
+
+var openAPIUI = template.Must(template.New("openapi").Parse(openAPIUISource))
+
+// openAPIUIHandler serves a Swagger UI page for the document at cfg.Path.
+func openAPIUIHandler(cfg openAPIConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = openAPIUI.Execute(w, map[string]string{
+			"Title":           cfg.Title,
+			"AssetsURL":       strings.TrimSuffix(cfg.UIAssetsURL, "/"),
+			"ScriptIntegrity": cfg.UIScriptIntegrity,
+			"StyleIntegrity":  cfg.UIStyleIntegrity,
+			"DocumentURL":     cfg.Path,
+			"Nonce":           CSPNonceFromContext(r.Context()),
+		})
+	})
+}
+
+// Operation describes a route in the OpenAPI document.
+type Operation struct {
+	ID          string
+	Summary     string
+	Description string
+	Tags        []string
+	Deprecated  bool
+
+	// Parameters describes path, query and header parameters. Path
+	// parameters of the route template that aren't described are added as
+	// required strings.
+	Parameters []Parameter
+
+	// Request is a value of the request body type, such as CreateInvoice{},
+	// or nil when the route takes no body.
+	Request any
+	// Response is a value of the response body type, or nil when the
+	// response has no body.
+	Response any
+	// Status is the status of a successful response, http.StatusOK when
+	// zero.
+	Status int
+	// Errors describes the error statuses of the route, which respond with
+	// RFC 9457 problem details.
+	Errors map[int]string
+}
+
+// Parameter describes a path, query or header parameter of an Operation.
+type Parameter struct {
+	Name        string
+	In          string
+	Description string
+	Required    bool
+	// Type is a value of the parameter's type, a string when nil.
+	Type any
+}
+
+// Document attaches op to the route handled by next, so the route is
+// described in the OpenAPI document. It must be the route's handler, or
+// wrapped by other route handlers such as MaxBodySize.
+func Document(op Operation, next http.Handler) http.Handler {
+	return &operationHandler{Handler: next, op: op}
+}
+
+type operationHandler struct {
+	http.Handler
+	op Operation
+}
+
+func (h *operationHandler) Unwrap() http.Handler {
+	return h.Handler
+}
+
+// routeParameters matches the variables of a mux route template.
+var routeParameters = regexp.MustCompile(`\{([^}:]+)(:[^}]*)?\}`)
+
+// openAPIDocument builds the OpenAPI 3.1 document of the routes on router.
+// Routes are listed under each of their methods, routes without methods and
+// path prefix routes are left out.
+func openAPIDocument(router *mux.Router, cfg openAPIConfig, skip ...*mux.Route) (map[string]any, error) {
+	schemas := newSchemaGenerator()
+	paths := make(map[string]map[string]any)
+
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		if route.GetHandler() == nil || slices.Contains(skip, route) {
+			return nil
+		}
+		methods, _ := route.GetMethods()
+		pathTemplate, _ := route.GetPathTemplate()
+		pathRegexp, _ := route.GetPathRegexp()
+		if len(methods) == 0 || pathTemplate == "" || !strings.HasSuffix(pathRegexp, "$") {
+			return nil
+		}
+
+		var op Operation
+		if h, ok := routeHandler[*operationHandler](route); ok {
+			op = h.op
+		}
+
+		path := routeParameters.ReplaceAllString(pathTemplate, "{$1}")
+		item := paths[path]
+		if item == nil {
+			item = make(map[string]any)
+			paths[path] = item
+		}
+
+		for _, method := range methods {
+			method = strings.ToLower(method)
+			if _, exists := item[method]; exists {
+				continue
+			}
+			operation, err := schemas.operation(op, pathTemplate, route.GetName())
+			if err != nil {
+				return fmt.Errorf("route %s %s: %w", strings.ToUpper(method), pathTemplate, err)
+			}
+			item[method] = operation
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	info := map[string]any{"title": cfg.Title, "version": cfg.Version}
+	if cfg.Description != "" {
+		info["description"] = cfg.Description
+	}
+
+	document := map[string]any{
+		"openapi": "3.1.0",
+		"info":    info,
+		"paths":   paths,
+	}
+	if len(schemas.components) > 0 {
+		document["components"] = map[string]any{"schemas": schemas.components}
+	}
+	return document, nil
+}
+
+// schemaGenerator reflects Go types into JSON schemas, with named struct
+// types as shared components.
+type schemaGenerator struct {
+	components map[string]any
+	names      map[reflect.Type]string
+}
+
+func newSchemaGenerator() *schemaGenerator {
+	return &schemaGenerator{components: make(map[string]any), names: make(map[reflect.Type]string)}
+}
+
+func (g *schemaGenerator) operation(op Operation, pathTemplate, name string) (map[string]any, error) {
+	operation := make(map[string]any)
+	if op.ID != "" {
+		operation["operationId"] = op.ID
+	} else if name != "" {
+		operation["operationId"] = name
+	}
+	if op.Summary != "" {
+		operation["summary"] = op.Summary
+	}
+	if op.Description != "" {
+		operation["description"] = op.Description
+	}
+	if len(op.Tags) > 0 {
+		operation["tags"] = op.Tags
+	}
+	if op.Deprecated {
+		operation["deprecated"] = true
+	}
+
+	var parameters []any
+	described := make(map[string]bool)
+	for _, p := range op.Parameters {
+		switch p.In {
+		case "path", "query", "header", "cookie":
+		default:
+			return nil, fmt.Errorf("parameter %q is in unknown location %q", p.Name, p.In)
+		}
+		described[p.In+" "+p.Name] = true
+
+		parameter := map[string]any{"name": p.Name, "in": p.In, "schema": g.valueSchema(p.Type)}
+		if p.Description != "" {
+			parameter["description"] = p.Description
+		}
+		if p.Required || p.In == "path" {
+			parameter["required"] = true
+		}
+		parameters = append(parameters, parameter)
+	}
+	for _, match := range routeParameters.FindAllStringSubmatch(pathTemplate, -1) {
+		if !described["path "+match[1]] {
+			parameters = append(parameters, map[string]any{"name": match[1], "in": "path", "required": true, "schema": map[string]any{"type": "string"}})
+		}
+	}
+	if len(parameters) > 0 {
+		operation["parameters"] = parameters
+	}
+
+	if op.Request != nil {
+		operation["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{"application/json": map[string]any{"schema": g.valueSchema(op.Request)}},
+		}
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := map[string]any{"description": http.StatusText(status)}
+	if op.Response != nil {
+		success["content"] = map[string]any{"application/json": map[string]any{"schema": g.valueSchema(op.Response)}}
+	}
+	responses := map[string]any{strconv.Itoa(status): success}
+
+	for code, description := range op.Errors {
+		if description == "" {
+			description = http.StatusText(code)
+		}
+		responses[strconv.Itoa(code)] = map[string]any{
+			"description": description,
+			"content":     map[string]any{"application/problem+json": map[string]any{"schema": g.problemSchema()}},
+		}
+	}
+	operation["responses"] = responses
+
+	return operation, nil
+}
+
+// problemSchema is the RFC 9457 problem details object.
+func (g *schemaGenerator) problemSchema() map[string]any {
+	if _, exists := g.components["Problem"]; !exists {
+		g.components["Problem"] = map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"type":     map[string]any{"type": "string", "format": "uri-reference"},
+				"title":    map[string]any{"type": "string"},
+				"status":   map[string]any{"type": "integer"},
+				"detail":   map[string]any{"type": "string"},
+				"instance": map[string]any{"type": "string", "format": "uri-reference"},
+			},
+		}
+	}
+	return map[string]any{"$ref": "#/components/schemas/Problem"}
+}
+
+func (g *schemaGenerator) valueSchema(v any) map[string]any {
+	if v == nil {
+		return map[string]any{"type": "string"}
+	}
+	return g.schema(reflect.TypeOf(v))
+}
+
+var (
+	timeType          = reflect.TypeFor[time.Time]()
+	jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+)
+
+func (g *schemaGenerator) schema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType):
+		// custom encodings can't be described
+		return map[string]any{}
+	case t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType):
+		return map[string]any{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return map[string]any{"type": "integer", "format": "int32"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return map[string]any{"type": "integer", "minimum": 0}
+	case reflect.Float32:
+		return map[string]any{"type": "number", "format": "float"}
+	case reflect.Float64:
+		return map[string]any{"type": "number", "format": "double"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		return g.component(t)
+	default:
+		return map[string]any{}
+	}
+}
+
+// component returns a reference to the shared schema of the named type t,
+// generating it the first time.
+func (g *schemaGenerator) component(t reflect.Type) map[string]any {
+	name, exists := g.names[t]
+	if !exists {
+		name = componentName(t.Name())
+		if _, taken := g.components[name]; taken {
+			name = componentName(t.PkgPath() + "." + t.Name())
+		}
+		g.names[t] = name
+
+		// reserved before generating, so recursive types refer back to it
+		g.components[name] = nil
+		g.components[name] = g.structSchema(t)
+	}
+	return map[string]any{"$ref": "#/components/schemas/" + name}
+}
+
+var componentNameInvalid = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+func componentName(name string) string {
+	return strings.Trim(componentNameInvalid.ReplaceAllString(name, "_"), "_")
+}
+
+// structSchema describes the fields of t as encoding/json encodes them.
+// Fields without omitempty or omitzero are required.
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	var required []string
+	g.fields(t, properties, &required)
+
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func (g *schemaGenerator) fields(t reflect.Type, properties map[string]any, required *[]string) {
+	for field := range t.Fields() {
+		// parameters decoded by Handle aren't part of the body
+		tag := field.Tag.Get("json")
+		if tag == "-" || field.Tag.Get("path") != "" || field.Tag.Get("query") != "" || field.Tag.Get("header") != "" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				g.fields(embedded, properties, required)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema := g.schema(field.Type)
+		if description := field.Tag.Get("description"); description != "" {
+			if _, ref := schema["$ref"]; ref {
+				// siblings of $ref are ignored by older tools
+				schema = map[string]any{"allOf": []any{schema}}
+			}
+			schema["description"] = description
+		}
+		properties[name] = schema
+
+		optional := false
+		for option := range strings.SplitSeq(options, ",") {
+			optional = optional || option == "omitempty" || option == "omitzero"
+		}
+		if !optional {
+			*required = append(*required, name)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type testInvoice struct {
+	ID       string         `json:"id" description:"The invoice number"`
+	Amount   float64        `json:"amount"`
+	Lines    []testLine     `json:"lines,omitempty"`
+	Customer *testCustomer  `json:"customer,omitempty"`
+	Due      time.Time      `json:"due"`
+	Labels   map[string]int `json:"labels,omitzero"`
+	Internal string         `json:"-"`
+	testAudit
+}
+
+type testAudit struct {
+	CreatedBy string `json:"created_by"`
+}
+
+type testLine struct {
+	Item  string    `json:"item"`
+	Price int32     `json:"price"`
+	Next  *testLine `json:"next,omitempty"`
+}
+
+type testCustomer struct {
+	Name string
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	handler := http.NotFoundHandler()
+	router := mux.NewRouter()
+	router.Handle("/invoices", Document(Operation{
+		Summary:  "Create an invoice",
+		Tags:     []string{"billing"},
+		Request:  testInvoice{},
+		Response: testInvoice{},
+		Status:   http.StatusCreated,
+		Errors:   map[int]string{http.StatusConflict: "The invoice exists"},
+	}, handler)).Methods(http.MethodPost)
+	router.Handle("/invoices/{id:[0-9]+}/lines/{line}", MaxBodySize(10, Document(Operation{
+		ID:         "getLine",
+		Parameters: []Parameter{{Name: "line", In: "path", Type: 0}, {Name: "expand", In: "query"}},
+		Response:   []testLine{},
+	}, handler))).Methods(http.MethodGet, http.MethodHead)
+	router.Handle("/undocumented", handler).Methods(http.MethodGet).Name("undocumented")
+	router.Handle("/any", handler)
+	router.PathPrefix("/static").Handler(handler).Methods(http.MethodGet)
+	skipped := router.Handle("/openapi.json", handler).Methods(http.MethodGet)
+
+	document, err := openAPIDocument(router, openAPIConfig{Title: "test", Version: "1.0.0"}, skipped)
+	if err != nil {
+		t.Fatalf("openapi document: %v", err)
+	}
+	encoded, err := json.Marshal(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+		Paths   map[string]map[string]struct {
+			OperationID string `json:"operationId"`
+			Summary     string `json:"summary"`
+			Parameters  []struct {
+				Name     string         `json:"name"`
+				In       string         `json:"in"`
+				Required bool           `json:"required"`
+				Schema   map[string]any `json:"schema"`
+			} `json:"parameters"`
+			RequestBody map[string]any            `json:"requestBody"`
+			Responses   map[string]map[string]any `json:"responses"`
+		} `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]map[string]any `json:"properties"`
+				Required   []string                  `json:"required"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(encoded, &doc); err != nil {
+		t.Fatalf("decode document: %v", err)
+	}
+
+	if doc.OpenAPI != "3.1.0" {
+		t.Errorf("openapi = %q", doc.OpenAPI)
+	}
+	var paths []string
+	for path := range doc.Paths {
+		paths = append(paths, path)
+	}
+	if len(paths) != 3 {
+		t.Errorf("paths = %v, want /invoices, /invoices/{id}/lines/{line} and /undocumented", paths)
+	}
+
+	create := doc.Paths["/invoices"]["post"]
+	if create.Summary != "Create an invoice" || create.RequestBody == nil {
+		t.Errorf("POST /invoices = %+v", create)
+	}
+	if _, ok := create.Responses["201"]["content"]; !ok {
+		t.Errorf("POST /invoices 201 has no content: %v", create.Responses)
+	}
+	if !strings.Contains(string(encoded), `"application/problem+json":{"schema":{"$ref":"#/components/schemas/Problem"}}`) {
+		t.Error("409 response doesn't refer to the problem schema")
+	}
+
+	line := doc.Paths["/invoices/{id}/lines/{line}"]
+	if line["get"].OperationID != "getLine" || line["head"].OperationID != "getLine" {
+		t.Errorf("lines operations = %+v", line)
+	}
+	parameters := make(map[string]string)
+	for _, p := range line["get"].Parameters {
+		parameters[p.In+" "+p.Name] = p.Schema["type"].(string)
+		if p.In == "path" && !p.Required {
+			t.Errorf("path parameter %q isn't required", p.Name)
+		}
+	}
+	if parameters["path id"] != "string" || parameters["path line"] != "integer" || parameters["query expand"] != "string" {
+		t.Errorf("parameters = %v", parameters)
+	}
+	if doc.Paths["/undocumented"]["get"].OperationID != "undocumented" {
+		t.Errorf("undocumented operation = %+v", doc.Paths["/undocumented"]["get"])
+	}
+
+	invoice := doc.Components.Schemas["testInvoice"]
+	if got := strings.Join(invoice.Required, ","); got != "id,amount,due,created_by" {
+		t.Errorf("invoice required = %s", got)
+	}
+	if invoice.Properties["id"]["description"] != "The invoice number" {
+		t.Errorf("invoice id = %v", invoice.Properties["id"])
+	}
+	if _, ok := invoice.Properties["Internal"]; ok {
+		t.Error("ignored field is documented")
+	}
+	if invoice.Properties["due"]["format"] != "date-time" {
+		t.Errorf("invoice due = %v", invoice.Properties["due"])
+	}
+	if ref := doc.Components.Schemas["testLine"].Properties["next"]["$ref"]; ref != "#/components/schemas/testLine" {
+		t.Errorf("recursive line next = %v", ref)
+	}
+	if _, ok := doc.Components.Schemas["testCustomer"].Properties["Name"]; !ok {
+		t.Error("customer has no Name property")
+	}
+}
+
+func TestOpenAPIUI(t *testing.T) {
+	handler := newSecurityHeaders(securityHeadersConfig{Enabled: true, ContentSecurityPolicy: "script-src 'nonce-{nonce}'"}, "").handler(openAPIUIHandler(openAPIConfig{
+		Path:              "/openapi.json",
+		UIAssetsURL:       "https://assets.example.com/swagger-ui-dist@5.17.14/",
+		UIScriptIntegrity: "sha384-script",
+		UIStyleIntegrity:  "sha384-style",
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs", nil))
+
+	nonce := strings.TrimSuffix(strings.TrimPrefix(w.Header().Get("Content-Security-Policy"), "script-src 'nonce-"), "'")
+	page := w.Body.String()
+	for _, want := range []string{
+		`<link rel="stylesheet" href="https://assets.example.com/swagger-ui-dist@5.17.14/swagger-ui.css" crossorigin="anonymous" integrity="sha384-style" nonce="` + nonce + `">`,
+		`<script src="https://assets.example.com/swagger-ui-dist@5.17.14/swagger-ui-bundle.js" crossorigin="anonymous" integrity="sha384-script" nonce="` + nonce + `"></script>`,
+		`<script nonce="` + nonce + `">`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page doesn't contain %s:\n%s", want, page)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Problem is an RFC 9457 problem details response. It's also an error, so
+// handlers can return one to choose the response.
+type Problem struct {
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Status   int    `json:"status,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+
+	err error
+}
+
+// NewProblem returns a problem with status, its standard title and detail.
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{Title: http.StatusText(status), Status: status, Detail: detail}
+}
+
+// Problemf returns a problem with status whose detail is formatted like
+// fmt.Errorf, wrapping any %w error.
+func Problemf(status int, format string, args ...any) *Problem {
+	err := fmt.Errorf(format, args...)
+	return &Problem{Title: http.StatusText(status), Status: status, Detail: err.Error(), err: errors.Unwrap(err)}
+}
+
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+	return p.Title
+}
+
+func (p *Problem) Unwrap() error {
+	return p.err
+}
+
+// ProblemFromError returns the problem describing err. Problems are returned
+// as they are, oversized request bodies are 413, expired deadlines 504 and
+// canceled requests 499. Other errors are 500 without their detail, which
+// may not be meant for clients.
+func ProblemFromError(err error) *Problem {
+	var problem *Problem
+	if errors.As(err, &problem) {
+		// problems may be shared, such as package level errors
+		p := *problem
+		if p.Status == 0 {
+			p.Status = http.StatusInternalServerError
+		}
+		if p.Title == "" {
+			p.Title = http.StatusText(p.Status)
+		}
+		return &p
+	}
+
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return &Problem{Title: http.StatusText(http.StatusRequestEntityTooLarge), Status: http.StatusRequestEntityTooLarge, Detail: fmt.Sprintf("request body is larger than %d bytes", maxBytesErr.Limit), err: err}
+	case errors.Is(err, context.DeadlineExceeded):
+		return &Problem{Title: http.StatusText(http.StatusGatewayTimeout), Status: http.StatusGatewayTimeout, err: err}
+	case errors.Is(err, context.Canceled):
+		// the client is gone, nginx's status for it is the most recognized
+		return &Problem{Title: "Client Closed Request", Status: 499, err: err}
+	default:
+		return &Problem{Title: http.StatusText(http.StatusInternalServerError), Status: http.StatusInternalServerError, err: err}
+	}
+}
+
+// WriteProblem responds with problem as application/problem+json.
+func WriteProblem(w http.ResponseWriter, problem *Problem) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Del("Content-Length")
+	w.WriteHeader(problem.Status)
+	_ = json.NewEncoder(w).Encode(problem)
+}
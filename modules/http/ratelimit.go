@@ -0,0 +1,366 @@
+package http
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/renevo/application"
+)
+
+type rateLimitConfig struct {
+	Enabled    bool                  `setting:"enabled" description:"Limit request rates with token buckets, returning 429 when a bucket is empty"`
+	Store      string                `setting:"store" description:"Where buckets are kept: memory, or nats to share them across replicas"`
+	NATSBucket string                `setting:"nats_bucket" description:"The NATS key/value bucket used by the nats store"`
+	Rules      []rateLimitRuleConfig `config:"rule,block"`
+}
+
+type rateLimitRuleConfig struct {
+	Name         string        `setting:"name" description:"The rule name, used in bucket keys and logs"`
+	Route        string        `setting:"route" description:"The route template the rule applies to, such as /users/{id}"`
+	PathPrefix   string        `setting:"path_prefix" description:"The path prefix the rule applies to when no route is set, matching whole path segments"`
+	Key          string        `setting:"key" description:"What requests are counted by: ip, api_key or route"`
+	APIKeyHeader string        `setting:"api_key_header" description:"The header carrying the API key, requests without one are counted by ip"`
+	Limit        int           `setting:"limit" description:"The number of requests allowed per period"`
+	Period       time.Duration `setting:"period" description:"The period the limit refills over"`
+	Burst        int           `setting:"burst" description:"The bucket size, defaults to limit"`
+}
+
+// rateLimitRule is a validated rule. Tokens refill at limit per period up to
+// burst.
+type rateLimitRule struct {
+	rateLimitRuleConfig
+	rate float64
+}
+
+func (r rateLimitRule) matches(route string, path string) bool {
+	if r.Route != "" {
+		return r.Route == route
+	}
+	return hasPathPrefix(path, r.PathPrefix)
+}
+
+// bucketKey returns the bucket the request is counted against.
+func (r rateLimitRule) bucketKey(req *http.Request) string {
+	switch r.Key {
+	case "route":
+		return r.Name
+	case "api_key":
+		if key := req.Header.Get(r.APIKeyHeader); key != "" {
+			// buckets may be stored outside the process, so the key itself
+			// never is
+			sum := sha256.Sum256([]byte(key))
+			return r.Name + ":key:" + hex.EncodeToString(sum[:])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	return r.Name + ":ip:" + host
+}
+
+// fullAfter returns how long an empty bucket takes to refill.
+func (r rateLimitRule) fullAfter() time.Duration {
+	return time.Duration(float64(r.Burst) / r.rate * float64(time.Second))
+}
+
+func parseRateLimitRules(configs []rateLimitRuleConfig) ([]rateLimitRule, error) {
+	rules := make([]rateLimitRule, 0, len(configs))
+	names := make(map[string]struct{}, len(configs))
+	for i, cfg := range configs {
+		if cfg.Name == "" {
+			cfg.Name = strconv.Itoa(i)
+		}
+		if _, exists := names[cfg.Name]; exists {
+			return nil, fmt.Errorf("rule %q is configured more than once", cfg.Name)
+		}
+		names[cfg.Name] = struct{}{}
+
+		if (cfg.Route == "") == (cfg.PathPrefix == "") {
+			return nil, fmt.Errorf("rule %q needs exactly one of route or path_prefix", cfg.Name)
+		}
+		if cfg.Limit <= 0 || cfg.Period <= 0 {
+			return nil, fmt.Errorf("rule %q needs a positive limit and period", cfg.Name)
+		}
+		switch cfg.Key {
+		case "":
+			cfg.Key = "ip"
+		case "ip", "route":
+		case "api_key":
+			if cfg.APIKeyHeader == "" {
+				cfg.APIKeyHeader = "X-API-Key"
+			}
+		default:
+			return nil, fmt.Errorf("rule %q has unknown key %q", cfg.Name, cfg.Key)
+		}
+		if cfg.Burst <= 0 {
+			cfg.Burst = cfg.Limit
+		}
+
+		rules = append(rules, rateLimitRule{rateLimitRuleConfig: cfg, rate: float64(cfg.Limit) / cfg.Period.Seconds()})
+	}
+	return rules, nil
+}
+
+// tokenBucket is the state of one bucket, stored as JSON in shared stores.
+type tokenBucket struct {
+	Tokens  float64   `json:"tokens"`
+	Updated time.Time `json:"updated"`
+}
+
+// take refills the bucket up to now and takes a token when one is available.
+func (b tokenBucket) take(rule rateLimitRule, now time.Time) (tokenBucket, rateLimitResult) {
+	if b.Updated.IsZero() {
+		b.Tokens = float64(rule.Burst)
+	} else if elapsed := now.Sub(b.Updated).Seconds(); elapsed > 0 {
+		b.Tokens = math.Min(float64(rule.Burst), b.Tokens+elapsed*rule.rate)
+	}
+	b.Updated = now
+
+	allowed := b.Tokens >= 1
+	if allowed {
+		b.Tokens--
+	}
+
+	return b, rateLimitResult{
+		allowed:    allowed,
+		remaining:  int(b.Tokens),
+		reset:      time.Duration((float64(rule.Burst) - b.Tokens) / rule.rate * float64(time.Second)),
+		retryAfter: time.Duration(math.Max(1-b.Tokens, 0) / rule.rate * float64(time.Second)),
+	}
+}
+
+type rateLimitResult struct {
+	allowed   bool
+	remaining int
+	// reset is how long until the bucket is full again
+	reset time.Duration
+	// retryAfter is how long until a token is available
+	retryAfter time.Duration
+}
+
+// rateLimitStore keeps token buckets.
+type rateLimitStore interface {
+	take(ctx context.Context, key string, rule rateLimitRule) (rateLimitResult, error)
+}
+
+// rateLimiter counts requests against the first matching rule.
+type rateLimiter struct {
+	rules  []rateLimitRule
+	store  rateLimitStore
+	logger *slog.Logger
+}
+
+func newRateLimiter(ctx *application.Context, cfg rateLimitConfig) (*rateLimiter, error) {
+	rules, err := parseRateLimitRules(cfg.Rules)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &rateLimiter{rules: rules, logger: ctx.Logger()}
+
+	switch cfg.Store {
+	case "", "memory":
+		l.store = newMemoryRateLimitStore()
+
+	case "nats":
+		if cfg.NATSBucket == "" {
+			return nil, errors.New("the nats store needs a nats_bucket")
+		}
+		nc := natsConn(ctx)
+		if nc == nil {
+			return nil, errors.New("the nats store requires a NATS connection, set nats.address")
+		}
+
+		js, err := jetstream.New(nc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create jetstream context: %w", err)
+		}
+
+		// idle buckets are full again by the time they expire
+		var ttl time.Duration
+		for _, rule := range rules {
+			ttl = max(ttl, rule.fullAfter())
+		}
+
+		kv, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+			Bucket:      cfg.NATSBucket,
+			Description: "HTTP rate limit buckets",
+			TTL:         max(ttl, time.Second),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create NATS key/value bucket %q: %w", cfg.NATSBucket, err)
+		}
+		l.store = &natsRateLimitStore{kv: kv, now: time.Now}
+
+	default:
+		return nil, fmt.Errorf("unknown store %q", cfg.Store)
+	}
+
+	return l, nil
+}
+
+// middleware applies the first rule matching the route template or path.
+// Requests are allowed when the store fails, so an outage doesn't take the
+// server down with it.
+func (l *rateLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var template string
+		if route := mux.CurrentRoute(r); route != nil {
+			template, _ = route.GetPathTemplate()
+		}
+
+		for _, rule := range l.rules {
+			if !rule.matches(template, r.URL.Path) {
+				continue
+			}
+
+			result, err := l.store.take(r.Context(), rule.bucketKey(r), rule)
+			if err != nil {
+				l.logger.WarnContext(r.Context(), "Rate Limit Store Failure", "rule", rule.Name, "err", err)
+				break
+			}
+
+			header := w.Header()
+			header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", rule.Limit, ceilSeconds(rule.Period)))
+			header.Set("RateLimit-Limit", strconv.Itoa(rule.Burst))
+			header.Set("RateLimit-Remaining", strconv.Itoa(result.remaining))
+			header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.reset)))
+
+			if !result.allowed {
+				header.Set("Retry-After", strconv.Itoa(max(ceilSeconds(result.retryAfter), 1)))
+				WriteProblem(w, Problemf(http.StatusTooManyRequests, "rate limit %q exceeded", rule.Name))
+				return
+			}
+			break
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// memoryRateLimitStore keeps buckets in process, so each replica limits on
+// its own.
+type memoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+	swept   time.Time
+	now     func() time.Time
+}
+
+type memoryBucket struct {
+	tokenBucket
+	fullAt time.Time
+}
+
+func newMemoryRateLimitStore() *memoryRateLimitStore {
+	return &memoryRateLimitStore{buckets: make(map[string]*memoryBucket), now: time.Now}
+}
+
+func (s *memoryRateLimitStore) take(_ context.Context, key string, rule rateLimitRule) (rateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+
+	// buckets that have refilled are the same as new ones, so drop them
+	if now.Sub(s.swept) > time.Minute {
+		for key, bucket := range s.buckets {
+			if now.After(bucket.fullAt) {
+				delete(s.buckets, key)
+			}
+		}
+		s.swept = now
+	}
+
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = &memoryBucket{}
+		s.buckets[key] = bucket
+	}
+
+	var result rateLimitResult
+	bucket.tokenBucket, result = bucket.take(rule, now)
+	bucket.fullAt = now.Add(result.reset)
+
+	return result, nil
+}
+
+// natsKeyValue is the part of jetstream.KeyValue used by the NATS store.
+type natsKeyValue interface {
+	Get(ctx context.Context, key string) (jetstream.KeyValueEntry, error)
+	Create(ctx context.Context, key string, value []byte, opts ...jetstream.KVCreateOpt) (uint64, error)
+	Update(ctx context.Context, key string, value []byte, revision uint64) (uint64, error)
+}
+
+// natsRateLimitStore keeps buckets in a JetStream key/value bucket shared by
+// every replica. Updates are compare-and-set on the key's revision and are
+// retried when another replica wins the race.
+type natsRateLimitStore struct {
+	kv  natsKeyValue
+	now func() time.Time
+}
+
+// natsRateLimitAttempts bounds the retries of a contended bucket.
+const natsRateLimitAttempts = 5
+
+func (s *natsRateLimitStore) take(ctx context.Context, key string, rule rateLimitRule) (rateLimitResult, error) {
+	key = natsCacheKey(key)
+
+	for range natsRateLimitAttempts {
+		var bucket tokenBucket
+		var revision uint64
+
+		entry, err := s.kv.Get(ctx, key)
+		switch {
+		case errors.Is(err, jetstream.ErrKeyNotFound):
+		case err != nil:
+			return rateLimitResult{}, err
+		default:
+			if err := json.Unmarshal(entry.Value(), &bucket); err != nil {
+				return rateLimitResult{}, fmt.Errorf("invalid bucket %q: %w", key, err)
+			}
+			revision = entry.Revision()
+		}
+
+		bucket, result := bucket.take(rule, s.now())
+		data, err := json.Marshal(bucket)
+		if err != nil {
+			return rateLimitResult{}, err
+		}
+
+		if revision == 0 {
+			_, err = s.kv.Create(ctx, key, data)
+		} else {
+			_, err = s.kv.Update(ctx, key, data, revision)
+		}
+		if errors.Is(err, jetstream.ErrKeyExists) {
+			continue
+		}
+		if err != nil {
+			return rateLimitResult{}, err
+		}
+
+		return result, nil
+	}
+
+	return rateLimitResult{}, fmt.Errorf("bucket %q is too contended to update", key)
+}
@@ -0,0 +1,224 @@
+package http
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func TestRateLimiterMiddleware(t *testing.T) {
+	rules, err := parseRateLimitRules([]rateLimitRuleConfig{
+		{Name: "users", Route: "/users/{id}", Limit: 2, Period: time.Minute},
+		{Name: "api", PathPrefix: "/api/", Key: "api_key", Limit: 1, Period: time.Second},
+	})
+	if err != nil {
+		t.Fatalf("parse rules: %v", err)
+	}
+
+	now := time.Unix(1000, 0)
+	store := newMemoryRateLimitStore()
+	store.now = func() time.Time { return now }
+	limiter := &rateLimiter{rules: rules, store: store, logger: slog.New(slog.DiscardHandler)}
+
+	router := mux.NewRouter()
+	router.Use(limiter.middleware)
+	router.HandleFunc("/users/{id}", func(http.ResponseWriter, *http.Request) {})
+	router.PathPrefix("/").HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+
+	request := func(path, remoteAddr, apiKey string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.RemoteAddr = remoteAddr
+		if apiKey != "" {
+			r.Header.Set("X-API-Key", apiKey)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	// route templates share a bucket across parameters
+	first := request("/users/1", "192.0.2.1:1000", "")
+	if first.Code != http.StatusOK || first.Header().Get("RateLimit-Remaining") != "1" {
+		t.Errorf("first request = %d remaining %q, want 200 remaining 1", first.Code, first.Header().Get("RateLimit-Remaining"))
+	}
+	if policy := first.Header().Get("RateLimit-Policy"); policy != "2;w=60" {
+		t.Errorf("RateLimit-Policy = %q, want 2;w=60", policy)
+	}
+	_ = request("/users/2", "192.0.2.1:1001", "")
+
+	limited := request("/users/3", "192.0.2.1:1002", "")
+	if limited.Code != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want %d", limited.Code, http.StatusTooManyRequests)
+	}
+	if limited.Header().Get("Content-Type") != "application/problem+json" {
+		t.Errorf("content type = %q, want problem details", limited.Header().Get("Content-Type"))
+	}
+	if retryAfter := limited.Header().Get("Retry-After"); retryAfter != "30" {
+		t.Errorf("Retry-After = %q, want 30", retryAfter)
+	}
+	if reset := limited.Header().Get("RateLimit-Reset"); reset != "60" {
+		t.Errorf("RateLimit-Reset = %q, want 60", reset)
+	}
+
+	// other clients have their own bucket
+	if w := request("/users/1", "192.0.2.2:1000", ""); w.Code != http.StatusOK {
+		t.Errorf("other client status = %d, want 200", w.Code)
+	}
+
+	// tokens refill over the period
+	now = now.Add(30 * time.Second)
+	if w := request("/users/1", "192.0.2.1:1000", ""); w.Code != http.StatusOK {
+		t.Errorf("refilled status = %d, want 200", w.Code)
+	}
+
+	// API keys are counted separately from the address they come from
+	_ = request("/api/items", "192.0.2.1:1000", "one")
+	if w := request("/api/items", "192.0.2.1:1000", "two"); w.Code != http.StatusOK {
+		t.Errorf("second API key status = %d, want 200", w.Code)
+	}
+	if w := request("/api/items", "192.0.2.3:1000", "one"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("reused API key status = %d, want 429", w.Code)
+	}
+
+	// unmatched requests aren't limited
+	if w := request("/other", "192.0.2.1:1000", ""); w.Header().Get("RateLimit-Limit") != "" {
+		t.Error("unmatched request has rate limit headers")
+	}
+}
+
+func TestRateLimitRulePathPrefix(t *testing.T) {
+	rules, err := parseRateLimitRules([]rateLimitRuleConfig{
+		{Name: "login", PathPrefix: "/api/login", Limit: 1, Period: time.Second},
+	})
+	if err != nil {
+		t.Fatalf("parse rules: %v", err)
+	}
+
+	for path, want := range map[string]bool{
+		"/api/login":       true,
+		"/api/login/2fa":   true,
+		"/api/login-help":  false,
+		"/api/loginhelper": false,
+	} {
+		if got := rules[0].matches("", path); got != want {
+			t.Errorf("matches(%q) = %t, want %t", path, got, want)
+		}
+	}
+}
+
+func TestRateLimitBucketKeyHashesAPIKey(t *testing.T) {
+	rules, err := parseRateLimitRules([]rateLimitRuleConfig{
+		{Name: "api", PathPrefix: "/", Key: "api_key", Limit: 1, Period: time.Second},
+	})
+	if err != nil {
+		t.Fatalf("parse rules: %v", err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-API-Key", "secret-key")
+	key := rules[0].bucketKey(r)
+	if strings.Contains(key, "secret-key") {
+		t.Errorf("bucket key %q contains the API key", key)
+	}
+
+	other := httptest.NewRequest(http.MethodGet, "/", nil)
+	other.Header.Set("X-API-Key", "other-key")
+	if key == rules[0].bucketKey(other) {
+		t.Error("different API keys share a bucket")
+	}
+}
+
+func TestParseRateLimitRulesInvalid(t *testing.T) {
+	for name, rule := range map[string]rateLimitRuleConfig{
+		"no match":   {Limit: 1, Period: time.Second},
+		"both match": {Route: "/", PathPrefix: "/", Limit: 1, Period: time.Second},
+		"no limit":   {Route: "/", Period: time.Second},
+		"no period":  {Route: "/", Limit: 1},
+		"bad key":    {Route: "/", Limit: 1, Period: time.Second, Key: "cookie"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parseRateLimitRules([]rateLimitRuleConfig{rule}); err == nil {
+				t.Error("invalid rule was accepted")
+			}
+		})
+	}
+}
+
+func TestNATSRateLimitStore(t *testing.T) {
+	rules, err := parseRateLimitRules([]rateLimitRuleConfig{{Route: "/", Limit: 3, Period: time.Minute}})
+	if err != nil {
+		t.Fatalf("parse rules: %v", err)
+	}
+
+	kv := &testKeyValue{entries: make(map[string]testKeyValueEntry), conflicts: 1}
+	store := &natsRateLimitStore{kv: kv, now: func() time.Time { return time.Unix(1000, 0) }}
+
+	for i, want := range []bool{true, true, true, false} {
+		result, err := store.take(t.Context(), "0:ip:192.0.2.1", rules[0])
+		if err != nil {
+			t.Fatalf("take %d: %v", i, err)
+		}
+		if result.allowed != want {
+			t.Errorf("take %d allowed = %t, want %t", i, result.allowed, want)
+		}
+	}
+	if len(kv.entries) != 1 {
+		t.Errorf("%d buckets stored, want 1", len(kv.entries))
+	}
+}
+
+// testKeyValue is an in-memory key/value bucket that reports a conflicting
+// write the first conflicts times a key is written.
+type testKeyValue struct {
+	mu        sync.Mutex
+	entries   map[string]testKeyValueEntry
+	conflicts int
+}
+
+type testKeyValueEntry struct {
+	jetstream.KeyValueEntry
+	value    []byte
+	revision uint64
+}
+
+func (e testKeyValueEntry) Value() []byte    { return e.value }
+func (e testKeyValueEntry) Revision() uint64 { return e.revision }
+
+func (kv *testKeyValue) Get(_ context.Context, key string) (jetstream.KeyValueEntry, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	entry, ok := kv.entries[key]
+	if !ok {
+		return nil, jetstream.ErrKeyNotFound
+	}
+	return entry, nil
+}
+
+func (kv *testKeyValue) Create(ctx context.Context, key string, value []byte, _ ...jetstream.KVCreateOpt) (uint64, error) {
+	return kv.Update(ctx, key, value, 0)
+}
+
+func (kv *testKeyValue) Update(_ context.Context, key string, value []byte, revision uint64) (uint64, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	if kv.conflicts > 0 {
+		kv.conflicts--
+		return 0, jetstream.ErrKeyExists
+	}
+	if kv.entries[key].revision != revision {
+		return 0, jetstream.ErrKeyExists
+	}
+
+	kv.entries[key] = testKeyValueEntry{value: value, revision: revision + 1}
+	return revision + 1, nil
+}
@@ -0,0 +1,129 @@
+package http
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/felixge/httpsnoop"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type recoveryConfig struct {
+	Type   string `setting:"type" description:"The problem type URI of the response to a panic"`
+	Title  string `setting:"title" description:"The problem title of the response to a panic"`
+	Detail string `setting:"detail" description:"The problem detail of the response to a panic"`
+}
+
+// recovery turns handler panics into 500 problem details, and reports them
+// through slog, the request span and a counter.
+type recovery struct {
+	problem Problem
+	panics  metric.Int64Counter
+}
+
+func newRecovery(meter metric.Meter, cfg recoveryConfig) (*recovery, error) {
+	rc := &recovery{problem: Problem{
+		Type:   cfg.Type,
+		Title:  cfg.Title,
+		Status: http.StatusInternalServerError,
+		Detail: cfg.Detail,
+	}}
+
+	var err error
+	rc.panics, err = meter.Int64Counter(
+		"http.server.request.panics",
+		metric.WithUnit("{panic}"),
+		metric.WithDescription("Number of requests whose handler panicked"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create panic counter: %w", err)
+	}
+
+	return rc, nil
+}
+
+func (rc *recovery) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var written bool
+		w = trackWritten(w, &written)
+
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			// the server aborts the response without logging it
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+
+			var route string
+			if current := mux.CurrentRoute(r); current != nil {
+				route, _ = current.GetPathTemplate()
+			}
+			stack := string(debug.Stack())
+			err := fmt.Errorf("panic: %v", v)
+
+			slog.ErrorContext(r.Context(), "HTTP Handler Panic", "method", r.Method, "route", route, "path", r.URL.Path, "panic", v, "stack", stack)
+
+			span := trace.SpanFromContext(r.Context())
+			span.RecordError(err, trace.WithAttributes(attribute.String("exception.stacktrace", stack)))
+			span.SetStatus(codes.Error, err.Error())
+
+			rc.panics.Add(r.Context(), 1, metric.WithAttributes(attribute.String("http.route", route)))
+
+			// a partial response can't be replaced, abort it so the client
+			// doesn't take it as complete
+			if written {
+				panic(http.ErrAbortHandler)
+			}
+
+			problem := rc.problem
+			WriteProblem(w, &problem)
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// trackWritten wraps w to set written once the final response is started.
+func trackWritten(w http.ResponseWriter, written *bool) http.ResponseWriter {
+	markWritten := func() { *written = true }
+	return httpsnoop.Wrap(w, httpsnoop.Hooks{
+		WriteHeader: func(next httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc {
+			return func(code int) {
+				// informational responses leave the final response unsent
+				if code >= 200 {
+					markWritten()
+				}
+				next(code)
+			}
+		},
+		Write: func(next httpsnoop.WriteFunc) httpsnoop.WriteFunc {
+			return func(p []byte) (int, error) {
+				markWritten()
+				return next(p)
+			}
+		},
+		ReadFrom: func(next httpsnoop.ReadFromFunc) httpsnoop.ReadFromFunc {
+			markWritten()
+			return next
+		},
+		Flush: func(next httpsnoop.FlushFunc) httpsnoop.FlushFunc {
+			return func() {
+				markWritten()
+				next()
+			}
+		},
+		Hijack: func(next httpsnoop.HijackFunc) httpsnoop.HijackFunc {
+			markWritten()
+			return next
+		},
+	})
+}
@@ -0,0 +1,90 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+func TestRecovery(t *testing.T) {
+	var logs bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	t.Cleanup(func() { _ = provider.Shutdown(t.Context()) })
+
+	rc, err := newRecovery(provider.Meter("test"), recoveryConfig{Type: "https://example.com/problems/panic", Title: "Internal Server Error", Detail: "Something broke."})
+	if err != nil {
+		t.Fatalf("new recovery: %v", err)
+	}
+
+	handler, recorder, _ := newTelemetryTestHandler(t, func(router *mux.Router, _ *telemetry) {
+		router.Use(rc.middleware)
+		router.HandleFunc("/panic/{id}", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			panic("boom")
+		})
+		router.HandleFunc("/partial", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("partial"))
+			panic("boom")
+		})
+	})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic/1", nil))
+
+	if w.Code != http.StatusInternalServerError || w.Header().Get("Content-Type") != "application/problem+json" {
+		t.Errorf("response = %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	var problem Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil || problem.Type != "https://example.com/problems/panic" || problem.Detail != "Something broke." || problem.Status != http.StatusInternalServerError {
+		t.Errorf("problem = %+v, %v", problem, err)
+	}
+
+	if !strings.Contains(logs.String(), `"msg":"HTTP Handler Panic"`) || !strings.Contains(logs.String(), `"route":"/panic/{id}"`) || !strings.Contains(logs.String(), "recovery_test.go") {
+		t.Errorf("log = %s", logs.String())
+	}
+
+	span := onlyEndedSpan(t, recorder)
+	if span.Status().Code != codes.Error {
+		t.Errorf("span status = %v, want error", span.Status().Code)
+	}
+	var stack bool
+	for _, event := range span.Events() {
+		for _, attr := range event.Attributes {
+			stack = stack || (event.Name == "exception" && attr.Key == "exception.stacktrace" && strings.Contains(attr.Value.AsString(), "recovery_test.go"))
+		}
+	}
+	if !stack {
+		t.Error("span has no exception event with the panic stack")
+	}
+
+	if count := int64Sum(t, reader, "http.server.request.panics", "http.route", "/panic/{id}"); count != 1 {
+		t.Errorf("panics = %d, want 1", count)
+	}
+
+	// a started response is aborted rather than followed by a problem
+	w = httptest.NewRecorder()
+	func() {
+		defer func() {
+			if v := recover(); v != http.ErrAbortHandler {
+				t.Errorf("recovered %v, want http.ErrAbortHandler", v)
+			}
+		}()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/partial", nil))
+	}()
+	if w.Body.String() != "partial" {
+		t.Errorf("partial body = %q", w.Body.String())
+	}
+}
@@ -0,0 +1,115 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/handlers"
+	"github.com/renevo/bootstrap/internal/requestid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type requestIDConfig struct {
+	Enabled       bool `setting:"enabled" description:"Give every request an ID, echoed in the X-Request-ID response header and carried by its context"`
+	TrustIncoming bool `setting:"trust_incoming" description:"Keep a valid ID sent by the client instead of generating one"`
+}
+
+// RequestIDFromContext returns the ID of the request that ctx belongs to, or
+// an empty string when request IDs are disabled.
+func RequestIDFromContext(ctx context.Context) string {
+	return requestid.FromContext(ctx)
+}
+
+// requestIDs accepts or generates the ID of each request and sets it on the
+// response, the request context and the request span.
+type requestIDs struct {
+	trustIncoming bool
+}
+
+func newRequestIDs(cfg requestIDConfig) *requestIDs {
+	return &requestIDs{trustIncoming: cfg.TrustIncoming}
+}
+
+func (ids *requestIDs) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestid.Header)
+		if !ids.trustIncoming || !requestid.Valid(id) {
+			id = rand.Text()
+			r.Header.Set(requestid.Header, id)
+		}
+
+		w.Header().Set(requestid.Header, id)
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("http.request.id", id))
+
+		next.ServeHTTP(w, r.WithContext(requestid.WithContext(r.Context(), id)))
+	})
+}
+
+// accessLogHandler writes a combined log line for each request to out, ending
+// with the quoted request ID when withID is set. The ID is assigned further in,
+// so it's taken from the response header it's echoed in.
+func accessLogHandler(out io.Writer, withID bool, next http.Handler) http.Handler {
+	if !withID {
+		return handlers.CombinedLoggingHandler(out, next)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.CombinedLoggingHandler(requestIDLogWriter{out: out, header: w.Header()}, next).ServeHTTP(w, r)
+	})
+}
+
+// requestIDLogWriter appends the request ID of the response header to the log
+// line written for it.
+type requestIDLogWriter struct {
+	out    io.Writer
+	header http.Header
+}
+
+func (l requestIDLogWriter) Write(line []byte) (int, error) {
+	id := l.header.Get(requestid.Header)
+	if id == "" {
+		return l.out.Write(line)
+	}
+
+	buf := make([]byte, 0, len(line)+len(id)+4)
+	buf = append(buf, bytes.TrimSuffix(line, []byte("\n"))...)
+	buf = append(buf, ' ')
+	buf = strconv.AppendQuote(buf, id)
+	buf = append(buf, '\n')
+	if _, err := l.out.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(line), nil
+}
+
+// LogHandler returns a slog.Handler that adds a request_id attribute to
+// records logged with the context of an HTTP request before passing them to
+// next.
+func LogHandler(next slog.Handler) slog.Handler {
+	return &requestIDLogHandler{Handler: next}
+}
+
+type requestIDLogHandler struct {
+	slog.Handler
+}
+
+func (h *requestIDLogHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := requestid.FromContext(ctx); id != "" {
+		record = record.Clone()
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *requestIDLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &requestIDLogHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *requestIDLogHandler) WithGroup(name string) slog.Handler {
+	return &requestIDLogHandler{Handler: h.Handler.WithGroup(name)}
+}
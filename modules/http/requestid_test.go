@@ -0,0 +1,90 @@
+package http
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestRequestIDs(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		incoming string
+		trust    bool
+		keep     bool
+	}{
+		{name: "generated"},
+		{name: "accepted", incoming: "ticket-1234", trust: true, keep: true},
+		{name: "untrusted", incoming: "ticket-1234"},
+		{name: "invalid", incoming: "has space", trust: true},
+		{name: "too long", incoming: strings.Repeat("x", 129), trust: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+			t.Cleanup(func() { _ = provider.Shutdown(t.Context()) })
+
+			var logs bytes.Buffer
+			logger := slog.New(LogHandler(slog.NewJSONHandler(&logs, nil))).With("component", "test")
+
+			var fromContext string
+			ids := newRequestIDs(requestIDConfig{TrustIncoming: test.trust})
+			handler := otelhttp.NewHandler(ids.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fromContext = RequestIDFromContext(r.Context())
+				logger.InfoContext(r.Context(), "handled")
+			})), "test", otelhttp.WithTracerProvider(provider))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.incoming != "" {
+				r.Header.Set("X-Request-ID", test.incoming)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			id := w.Header().Get("X-Request-ID")
+			if id == "" {
+				t.Fatal("response has no X-Request-ID")
+			}
+			if test.keep != (id == test.incoming) {
+				t.Errorf("X-Request-ID = %q, incoming %q kept = %t, want %t", id, test.incoming, id == test.incoming, test.keep)
+			}
+			if fromContext != id {
+				t.Errorf("RequestIDFromContext = %q, want %q", fromContext, id)
+			}
+			if !strings.Contains(logs.String(), `"request_id":"`+id+`"`) {
+				t.Errorf("log %s has no request_id %q", logs.String(), id)
+			}
+			if value, ok := spanAttribute(onlyEndedSpan(t, recorder), "http.request.id"); !ok || value.AsString() != id {
+				t.Errorf("http.request.id = %v, want %q", value.AsInterface(), id)
+			}
+		})
+	}
+}
+
+func TestLogHandlerWithoutRequestID(t *testing.T) {
+	var logs bytes.Buffer
+	slog.New(LogHandler(slog.NewJSONHandler(&logs, nil))).InfoContext(t.Context(), "startup")
+	if strings.Contains(logs.String(), "request_id") {
+		t.Errorf("log %s has a request_id outside of a request", logs.String())
+	}
+}
+
+func TestAccessLogRequestID(t *testing.T) {
+	var logs bytes.Buffer
+	handler := accessLogHandler(&logs, true, newRequestIDs(requestIDConfig{TrustIncoming: true}).handler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Request-ID", `abc"123`)
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	if line := logs.String(); !strings.HasSuffix(line, `" "abc\"123"`+"\n") || strings.Count(line, "\n") != 1 {
+		t.Errorf("access log %q doesn't end with the request ID", line)
+	}
+}
@@ -2,6 +2,7 @@ package http
 
 import (
 	"context"
+	"net/http"
 
 	"github.com/gorilla/mux"
 )
@@ -13,3 +14,46 @@ type Routable interface {
 	// phase. Returning an error prevents the application from starting.
 	Route(ctx context.Context, router *mux.Router) error
 }
+
+// RoutePrioritizer is implemented by Routable, MountedRoutable and
+// MiddlewareProvider modules that need their routes and middleware registered
+// before or after those of other modules.
+type RoutePrioritizer interface {
+	// RoutePriority orders the module's Route call and middleware: lower
+	// priorities are routed first, and mux matches routes in the order
+	// they're registered.
+	// Modules without a priority have priority zero, and modules with the
+	// same priority are routed in order of their names.
+	RoutePriority() int
+}
+
+// MountedRoutable is implemented by application modules that register their
+// routes and middleware on a subrouter of their own. The subrouter matches
+// the path prefix and host set by the module's http.mount block, or every
+// request without one, and middleware registered on it only runs for the
+// module's routes. Modules may implement both Routable and MountedRoutable.
+type MountedRoutable interface {
+	// Mount registers handlers or middleware during the HTTP module's Start
+	// phase. Returning an error prevents the application from starting.
+	Mount(ctx context.Context, router *mux.Router) error
+}
+
+// routeHandler returns the handler of type T in the chain of route handlers
+// wrapping each other through an Unwrap method, such as MaxBodySize(limit,
+// Document(op, handler)).
+func routeHandler[T http.Handler](route *mux.Route) (T, bool) {
+	h := route.GetHandler()
+	for h != nil {
+		if found, ok := h.(T); ok {
+			return found, true
+		}
+		unwrapper, ok := h.(interface{ Unwrap() http.Handler })
+		if !ok {
+			break
+		}
+		h = unwrapper.Unwrap()
+	}
+
+	var zero T
+	return zero, false
+}
@@ -0,0 +1,295 @@
+package http
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/gorilla/mux"
+	"github.com/renevo/application"
+)
+
+type mountConfig struct {
+	Module string `config:"name,label"`
+	Prefix string `setting:"prefix" description:"The path prefix the module's routes are mounted under, such as /api/billing"`
+	Host   string `setting:"host" description:"The host template the module's routes match, such as billing.example.com"`
+}
+
+// namedModule is an application module and the name it was registered
+// under.
+type namedModule struct {
+	name     string
+	priority int
+	module   application.Module
+}
+
+// orderedModules returns the modules matching include in the order they're
+// routed: by priority, then by name, so the order doesn't change between
+// runs.
+func orderedModules(modules map[string]application.Module, include func(application.Module) bool) []namedModule {
+	var ordered []namedModule
+	for name, mod := range modules {
+		if !include(mod) {
+			continue
+		}
+
+		r := namedModule{name: name, module: mod}
+		if prioritizer, ok := mod.(RoutePrioritizer); ok {
+			r.priority = prioritizer.RoutePriority()
+		}
+		ordered = append(ordered, r)
+	}
+
+	slices.SortFunc(ordered, func(a, b namedModule) int {
+		return cmp.Or(cmp.Compare(a.priority, b.priority), strings.Compare(a.name, b.name))
+	})
+	return ordered
+}
+
+// routables returns the modules that register routes in the order they're
+// routed.
+func routables(modules map[string]application.Module) []namedModule {
+	return orderedModules(modules, func(mod application.Module) bool {
+		_, routable := mod.(Routable)
+		_, mounted := mod.(MountedRoutable)
+		return routable || mounted
+	})
+}
+
+// route registers the module's routes on router, and on a subrouter for the
+// module's mount when it's a MountedRoutable.
+func (r namedModule) route(ctx context.Context, router *mux.Router, mount mountConfig) error {
+	if routable, ok := r.module.(Routable); ok {
+		if err := routable.Route(ctx, router); err != nil {
+			return err
+		}
+	}
+
+	mounted, ok := r.module.(MountedRoutable)
+	if !ok {
+		return nil
+	}
+
+	subrouter := router.NewRoute()
+	if mount.Host != "" {
+		subrouter = subrouter.Host(mount.Host)
+	}
+	if mount.Prefix != "" {
+		subrouter = subrouter.PathPrefix(mount.Prefix)
+	}
+	return mounted.Mount(ctx, subrouter.Subrouter())
+}
+
+// parseMounts returns the mounts by module name. Every mount must name a
+// MountedRoutable module.
+func parseMounts(cfgs []mountConfig, ordered []namedModule) (map[string]mountConfig, error) {
+	mounts := make(map[string]mountConfig, len(cfgs))
+	for _, mount := range cfgs {
+		if _, exists := mounts[mount.Module]; exists {
+			return nil, fmt.Errorf("module %q is mounted more than once", mount.Module)
+		}
+
+		i := slices.IndexFunc(ordered, func(r namedModule) bool { return r.name == mount.Module })
+		if i < 0 {
+			return nil, fmt.Errorf("module %q is not a mounted routable module", mount.Module)
+		}
+		if _, ok := ordered[i].module.(MountedRoutable); !ok {
+			return nil, fmt.Errorf("module %q is not a mounted routable module", mount.Module)
+		}
+
+		if mount.Prefix != "" && !strings.HasPrefix(mount.Prefix, "/") {
+			return nil, fmt.Errorf("prefix %q of module %q must start with /", mount.Prefix, mount.Module)
+		}
+		mount.Prefix = strings.TrimSuffix(mount.Prefix, "/")
+
+		mounts[mount.Module] = mount
+	}
+	return mounts, nil
+}
+
+// routeInfo describes a route in the route table.
+type routeInfo struct {
+	Module  string   `json:"module"`
+	Name    string   `json:"name,omitempty"`
+	Methods []string `json:"methods,omitempty"`
+	Path    string   `json:"path,omitempty"`
+	Host    string   `json:"host,omitempty"`
+	// Middleware lists the middleware the route runs through, in order.
+	// Middleware added with mux.Router.Use has no name and is listed as
+	// the module that added it followed by :use.
+	Middleware []string `json:"middleware,omitempty"`
+
+	pathRegexp string
+}
+
+func (r routeInfo) String() string {
+	methods := "*"
+	if len(r.Methods) > 0 {
+		methods = strings.Join(r.Methods, ",")
+	}
+	return fmt.Sprintf("%s %s%s", methods, r.Host, r.Path)
+}
+
+// routeTable records which module registered each route, and the
+// middleware every route runs through.
+type routeTable struct {
+	owners map[*mux.Route]string
+	// middleware runs for every route: the pre-routing middleware and the
+	// middleware used by the root router
+	middleware []string
+	used       int
+	err        error
+}
+
+func newRouteTable() *routeTable {
+	return &routeTable{owners: make(map[*mux.Route]string)}
+}
+
+// use records named middleware that runs for every route, either before
+// routing or used by router since the last call.
+func (t *routeTable) use(router *mux.Router, names ...string) {
+	t.middleware = append(t.middleware, names...)
+	t.used = t.countMiddleware(router)
+}
+
+// claim assigns the routes added to router since the last claim, and the
+// middleware it used since, to module.
+func (t *routeTable) claim(router *mux.Router, module string) {
+	for used := t.countMiddleware(router); t.used < used; t.used++ {
+		t.middleware = append(t.middleware, module+":use")
+	}
+
+	_ = router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		if _, owned := t.owners[route]; !owned {
+			t.owners[route] = module
+		}
+		return nil
+	})
+}
+
+// errUncountedMiddleware is reported when the mux in use no longer keeps its
+// middleware where usedMiddleware looks for it.
+var errUncountedMiddleware = errors.New("http: can't count router middleware, gorilla/mux has no middlewares field")
+
+// usedMiddleware returns the number of middleware added to router with Use.
+// mux doesn't expose them, so they're counted through reflection, and a mux
+// without the field fails the route table rather than under-reporting it.
+func usedMiddleware(router *mux.Router) (int, error) {
+	middlewares := reflect.ValueOf(router).Elem().FieldByName("middlewares")
+	if middlewares.Kind() != reflect.Slice {
+		return 0, errUncountedMiddleware
+	}
+	return middlewares.Len(), nil
+}
+
+// countMiddleware counts the middleware of router, keeping the first failure
+// for build to return.
+func (t *routeTable) countMiddleware(router *mux.Router) int {
+	used, err := usedMiddleware(router)
+	if t.err == nil {
+		t.err = err
+	}
+	return used
+}
+
+// build returns the routes in the order mux matches them. It fails when two
+// modules register the same method, host and path.
+func (t *routeTable) build(router *mux.Router) ([]routeInfo, error) {
+	if t.err != nil {
+		return nil, t.err
+	}
+
+	var routes []routeInfo
+	subrouters := make(map[*mux.Route]*mux.Router)
+	err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		if len(ancestors) > 0 {
+			subrouters[ancestors[len(ancestors)-1]] = router
+		}
+
+		// subrouters match on behalf of their routes
+		if route.GetHandler() == nil {
+			return nil
+		}
+
+		info := routeInfo{Module: t.owners[route], Name: route.GetName()}
+		info.Methods, _ = route.GetMethods()
+		info.Path, _ = route.GetPathTemplate()
+		info.pathRegexp, _ = route.GetPathRegexp()
+		info.Host, _ = route.GetHostTemplate()
+
+		// the middleware of subrouters runs inside the root router's, and
+		// belongs to the module that mounted the route
+		info.Middleware = slices.Clone(t.middleware)
+		for _, ancestor := range ancestors {
+			used, err := usedMiddleware(subrouters[ancestor])
+			if err != nil {
+				return err
+			}
+			for range used {
+				info.Middleware = append(info.Middleware, info.Module+":use")
+			}
+		}
+
+		for _, existing := range routes {
+			if existing.Module != info.Module && existing.conflicts(info) {
+				return fmt.Errorf("route %s of module %q conflicts with route %s of module %q", info, info.Module, existing, existing.Module)
+			}
+		}
+
+		routes = append(routes, info)
+		return nil
+	})
+	return routes, err
+}
+
+// conflicts reports whether both routes match the same requests by method,
+// host and path. Routes without a path, such as those matching on headers
+// alone, never conflict.
+func (r routeInfo) conflicts(other routeInfo) bool {
+	if r.pathRegexp == "" || r.pathRegexp != other.pathRegexp || r.Host != other.Host {
+		return false
+	}
+	if len(r.Methods) == 0 || len(other.Methods) == 0 {
+		return true
+	}
+	for _, method := range r.Methods {
+		if slices.Contains(other.Methods, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeRoutes writes the route table as aligned text or as JSON.
+func writeRoutes(w io.Writer, routes []routeInfo, format string) error {
+	switch format {
+	case "json":
+		if routes == nil {
+			routes = []routeInfo{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(routes)
+	case "", "text":
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "METHODS\tPATH\tHOST\tMODULE\tNAME\tMIDDLEWARE")
+		for _, route := range routes {
+			methods := "*"
+			if len(route.Methods) > 0 {
+				methods = strings.Join(route.Methods, ",")
+			}
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				methods, cmp.Or(route.Path, "-"), cmp.Or(route.Host, "-"), route.Module, cmp.Or(route.Name, "-"), cmp.Or(strings.Join(route.Middleware, ","), "-"))
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown route table format %q", format)
+	}
+}
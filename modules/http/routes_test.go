@@ -0,0 +1,337 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/renevo/application"
+)
+
+type testRoutable struct {
+	priority int
+	route    func(router *mux.Router)
+}
+
+func (m *testRoutable) Start(*application.Context) error { return nil }
+func (m *testRoutable) Stop(*application.Context) error  { return nil }
+func (m *testRoutable) RoutePriority() int               { return m.priority }
+func (m *testRoutable) Route(_ context.Context, router *mux.Router) error {
+	m.route(router)
+	return nil
+}
+
+type testUnprioritized struct{ testRoutable }
+
+func (m *testUnprioritized) RoutePriority() {}
+
+func TestRoutablesOrder(t *testing.T) {
+	noop := func(*mux.Router) {}
+	modules := map[string]application.Module{
+		"zeta":    &testRoutable{route: noop},
+		"alpha":   &testRoutable{route: noop},
+		"first":   &testRoutable{priority: -10, route: noop},
+		"last":    &testRoutable{priority: 10, route: noop},
+		"default": &testUnprioritized{testRoutable{priority: 5, route: noop}},
+	}
+
+	for range 10 {
+		var names []string
+		for _, r := range routables(modules) {
+			names = append(names, r.name)
+		}
+		if want := []string{"first", "alpha", "default", "zeta", "last"}; !slices.Equal(names, want) {
+			t.Fatalf("routing order = %v, want %v", names, want)
+		}
+	}
+}
+
+func TestRouteTable(t *testing.T) {
+	handler := http.NotFoundHandler()
+
+	for _, test := range []struct {
+		name     string
+		modules  map[string]func(*mux.Router)
+		conflict string
+	}{
+		{
+			name: "distinct",
+			modules: map[string]func(*mux.Router){
+				"billing": func(r *mux.Router) {
+					r.Handle("/invoices", handler).Methods(http.MethodGet).Name("invoices")
+					r.PathPrefix("/api").Subrouter().Handle("/invoices/{id}", handler)
+				},
+				"users": func(r *mux.Router) {
+					r.Handle("/invoices", handler).Methods(http.MethodPost)
+					r.Handle("/invoices", handler).Host("admin.example.com")
+					r.PathPrefix("/invoices").Handler(handler)
+				},
+			},
+		},
+		{
+			name: "same method",
+			modules: map[string]func(*mux.Router){
+				"billing": func(r *mux.Router) { r.Handle("/invoices", handler).Methods(http.MethodGet, http.MethodPost) },
+				"users":   func(r *mux.Router) { r.Handle("/invoices", handler).Methods(http.MethodPost) },
+			},
+			conflict: `route POST /invoices of module "users" conflicts with route GET,POST /invoices of module "billing"`,
+		},
+		{
+			name: "any method",
+			modules: map[string]func(*mux.Router){
+				"billing": func(r *mux.Router) { r.Handle("/invoices/{id}", handler).Methods(http.MethodGet) },
+				"users":   func(r *mux.Router) { r.Handle("/invoices/{id}", handler) },
+			},
+			conflict: `conflicts with route GET /invoices/{id} of module "billing"`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			modules := make(map[string]application.Module)
+			for name, route := range test.modules {
+				modules[name] = &testRoutable{route: route}
+			}
+
+			router := mux.NewRouter()
+			router.Handle("/metrics", handler)
+			table := newRouteTable()
+			table.claim(router, "HTTP")
+			for _, r := range routables(modules) {
+				if err := r.route(t.Context(), router, mountConfig{}); err != nil {
+					t.Fatal(err)
+				}
+				table.claim(router, r.name)
+			}
+
+			routes, err := table.build(router)
+			if test.conflict != "" {
+				if err == nil || !strings.Contains(err.Error(), test.conflict) {
+					t.Fatalf("build error = %v, want %q", err, test.conflict)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("build: %v", err)
+			}
+
+			var got []string
+			for _, route := range routes {
+				got = append(got, route.Module+" "+route.String()+" "+route.Name)
+			}
+			want := []string{
+				"HTTP * /metrics ",
+				"billing GET /invoices invoices",
+				"billing * /api/invoices/{id} ",
+				"users POST /invoices ",
+				"users * admin.example.com/invoices ",
+				"users * /invoices ",
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("routes =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+			}
+		})
+	}
+}
+
+func TestRouteTableMiddleware(t *testing.T) {
+	handler := http.NotFoundHandler()
+	passthrough := func(next http.Handler) http.Handler { return next }
+
+	billing := &testMounted{
+		testRoutable: testRoutable{route: func(r *mux.Router) {
+			r.Use(passthrough)
+			r.Handle("/root", handler)
+		}},
+		mount: func(r *mux.Router) {
+			r.Use(passthrough, passthrough)
+			r.Handle("/invoices", handler)
+		},
+	}
+	modules := map[string]application.Module{
+		"billing": billing,
+		"users":   &testRoutable{route: func(r *mux.Router) { r.Handle("/users", handler) }},
+	}
+
+	ordered := routables(modules)
+	mounts, err := parseMounts([]mountConfig{{Module: "billing", Prefix: "/api/billing"}}, ordered)
+	if err != nil {
+		t.Fatalf("parse mounts: %v", err)
+	}
+
+	router := mux.NewRouter()
+	table := newRouteTable()
+	table.use(router, "request_id")
+	router.Use(passthrough)
+	table.use(router, "recovery")
+	router.Handle("/metrics", handler)
+	table.claim(router, "HTTP")
+	for _, r := range ordered {
+		if err := r.route(t.Context(), router, mounts[r.name]); err != nil {
+			t.Fatal(err)
+		}
+		table.claim(router, r.name)
+	}
+	router.Use(passthrough)
+	table.use(router, "auth")
+
+	routes, err := table.build(router)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	global := []string{"request_id", "recovery", "billing:use", "auth"}
+	want := map[string][]string{
+		"/metrics":              global,
+		"/root":                 global,
+		"/api/billing/invoices": append(slices.Clone(global), "billing:use", "billing:use"),
+		"/users":                global,
+	}
+	for _, route := range routes {
+		if !slices.Equal(route.Middleware, want[route.Path]) {
+			t.Errorf("%s middleware = %v, want %v", route.Path, route.Middleware, want[route.Path])
+		}
+	}
+}
+
+func TestUsedMiddleware(t *testing.T) {
+	router := mux.NewRouter()
+	passthrough := func(next http.Handler) http.Handler { return next }
+	router.Use(passthrough, passthrough)
+	router.Use(passthrough)
+
+	// fails when a mux upgrade moves the field the count is read from
+	if used, err := usedMiddleware(router); err != nil || used != 3 {
+		t.Fatalf("usedMiddleware = %d, %v, want 3", used, err)
+	}
+}
+
+type testMounted struct {
+	testRoutable
+	mount func(router *mux.Router)
+}
+
+func (m *testMounted) Mount(_ context.Context, router *mux.Router) error {
+	m.mount(router)
+	return nil
+}
+
+func TestMountedRoutable(t *testing.T) {
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.Path + " " + w.Header().Get("X-Billing")))
+	})
+
+	billing := &testMounted{
+		testRoutable: testRoutable{route: func(r *mux.Router) {
+			r.Handle("/root", echo)
+		}},
+		mount: func(r *mux.Router) {
+			r.Use(func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("X-Billing", "scoped")
+					next.ServeHTTP(w, r)
+				})
+			})
+			r.Handle("/invoices", echo)
+		},
+	}
+	modules := map[string]application.Module{
+		"billing": billing,
+		"users":   &testRoutable{route: func(r *mux.Router) { r.Handle("/users", echo) }},
+	}
+
+	ordered := routables(modules)
+	mounts, err := parseMounts([]mountConfig{{Module: "billing", Prefix: "/api/billing/", Host: "{tenant}.example.com"}}, ordered)
+	if err != nil {
+		t.Fatalf("parse mounts: %v", err)
+	}
+
+	handler, recorder, _ := newTelemetryTestHandler(t, func(router *mux.Router, telemetry *telemetry) {
+		table := newRouteTable()
+		for _, r := range ordered {
+			if err := r.route(t.Context(), router, mounts[r.name]); err != nil {
+				t.Fatal(err)
+			}
+			table.claim(router, r.name)
+		}
+		if _, err := table.build(router); err != nil {
+			t.Fatal(err)
+		}
+		telemetry.modules = table.owners
+	})
+
+	for _, test := range []struct {
+		url    string
+		status int
+		body   string
+		module string
+	}{
+		{url: "http://acme.example.com/api/billing/invoices", status: http.StatusOK, body: "/api/billing/invoices scoped", module: "billing"},
+		{url: "http://other.test/api/billing/invoices", status: http.StatusNotFound},
+		{url: "http://acme.example.com/invoices", status: http.StatusNotFound},
+		{url: "http://acme.example.com/root", status: http.StatusOK, body: "/root ", module: "billing"},
+		{url: "http://acme.example.com/users", status: http.StatusOK, body: "/users ", module: "users"},
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.url, nil))
+		if w.Code != test.status || (test.body != "" && w.Body.String() != test.body) {
+			t.Errorf("%s = %d %q, want %d %q", test.url, w.Code, w.Body.String(), test.status, test.body)
+		}
+
+		spans := recorder.Ended()
+		value, _ := spanAttribute(spans[len(spans)-1], "http.route.module")
+		if value.AsString() != test.module {
+			t.Errorf("%s http.route.module = %q, want %q", test.url, value.AsString(), test.module)
+		}
+	}
+
+	for _, cfgs := range [][]mountConfig{
+		{{Module: "users", Prefix: "/users"}},
+		{{Module: "missing"}},
+		{{Module: "billing", Prefix: "api"}},
+		{{Module: "billing"}, {Module: "billing"}},
+	} {
+		if _, err := parseMounts(cfgs, ordered); err == nil {
+			t.Errorf("parse mounts %+v succeeded", cfgs)
+		}
+	}
+}
+
+func TestWriteRoutes(t *testing.T) {
+	routes := []routeInfo{
+		{Module: "HTTP", Methods: []string{http.MethodGet}, Path: "/metrics", Middleware: []string{"request_id", "recovery"}},
+		{Module: "billing", Name: "invoice", Path: "/invoices/{id}", Host: "billing.example.com"},
+	}
+
+	var text strings.Builder
+	if err := writeRoutes(&text, routes, "text"); err != nil {
+		t.Fatal(err)
+	}
+	want := `METHODS  PATH            HOST                 MODULE   NAME     MIDDLEWARE
+GET      /metrics        -                    HTTP     -        request_id,recovery
+*        /invoices/{id}  billing.example.com  billing  invoice  -
+`
+	if text.String() != want {
+		t.Errorf("text routes =\n%s\nwant\n%s", text.String(), want)
+	}
+
+	var encoded strings.Builder
+	if err := writeRoutes(&encoded, routes, "json"); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []routeInfo
+	if err := json.Unmarshal([]byte(encoded.String()), &decoded); err != nil {
+		t.Fatalf("decode json routes: %v", err)
+	}
+	if len(decoded) != 2 || decoded[1].Host != "billing.example.com" || !slices.Equal(decoded[0].Middleware, routes[0].Middleware) {
+		t.Errorf("json routes = %s", encoded.String())
+	}
+
+	if err := writeRoutes(io.Discard, routes, "yaml"); err == nil {
+		t.Error("yaml format succeeded")
+	}
+}
@@ -0,0 +1,142 @@
+package http
+
+import (
+	"context"
+	"crypto/rand"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type securityHeadersConfig struct {
+	Enabled                   bool          `setting:"enabled" description:"Add security headers to every response, an empty header value leaves the header out"`
+	HSTSMaxAge                time.Duration `setting:"hsts_max_age" description:"The Strict-Transport-Security max-age sent over HTTPS, zero disables HSTS"`
+	HSTSIncludeSubdomains     bool          `setting:"hsts_include_subdomains" description:"Apply Strict-Transport-Security to subdomains"`
+	HSTSPreload               bool          `setting:"hsts_preload" description:"Request inclusion in browser HSTS preload lists"`
+	ContentSecurityPolicy     string        `setting:"content_security_policy" description:"The Content-Security-Policy, {nonce} is replaced with a nonce generated for each request"`
+	CSPReportOnly             bool          `setting:"csp_report_only" description:"Send the policy as Content-Security-Policy-Report-Only"`
+	ContentTypeOptions        string        `setting:"content_type_options" description:"The X-Content-Type-Options header"`
+	FrameOptions              string        `setting:"frame_options" description:"The X-Frame-Options header"`
+	ReferrerPolicy            string        `setting:"referrer_policy" description:"The Referrer-Policy header"`
+	PermissionsPolicy         string        `setting:"permissions_policy" description:"The Permissions-Policy header"`
+	CrossOriginOpenerPolicy   string        `setting:"cross_origin_opener_policy" description:"The Cross-Origin-Opener-Policy header"`
+	CrossOriginEmbedderPolicy string        `setting:"cross_origin_embedder_policy" description:"The Cross-Origin-Embedder-Policy header"`
+}
+
+type cspNonceKey struct{}
+
+// CSPNonceFromContext returns the Content-Security-Policy nonce of the request
+// that ctx belongs to, for use in nonce attributes of inline scripts and
+// styles. It's empty unless the policy contains {nonce}.
+func CSPNonceFromContext(ctx context.Context) string {
+	nonce, _ := ctx.Value(cspNonceKey{}).(string)
+	return nonce
+}
+
+// securityHeaders sets the Server header and, when enabled, the configured
+// security headers before the request is handled, so handlers may still
+// override them.
+type securityHeaders struct {
+	server  string
+	enabled bool
+	hsts    string
+	csp     string
+	cspName string
+	static  [][2]string
+}
+
+func newSecurityHeaders(cfg securityHeadersConfig, server string) *securityHeaders {
+	h := &securityHeaders{
+		server:  server,
+		enabled: cfg.Enabled,
+		csp:     cfg.ContentSecurityPolicy,
+		cspName: "Content-Security-Policy",
+	}
+	if cfg.CSPReportOnly {
+		h.cspName = "Content-Security-Policy-Report-Only"
+	}
+
+	if cfg.HSTSMaxAge > 0 {
+		h.hsts = "max-age=" + strconv.Itoa(int(cfg.HSTSMaxAge.Seconds()))
+		if cfg.HSTSIncludeSubdomains {
+			h.hsts += "; includeSubDomains"
+		}
+		if cfg.HSTSPreload {
+			h.hsts += "; preload"
+		}
+	}
+
+	for _, header := range [][2]string{
+		{"X-Content-Type-Options", cfg.ContentTypeOptions},
+		{"X-Frame-Options", cfg.FrameOptions},
+		{"Referrer-Policy", cfg.ReferrerPolicy},
+		{"Permissions-Policy", cfg.PermissionsPolicy},
+		{"Cross-Origin-Opener-Policy", cfg.CrossOriginOpenerPolicy},
+		{"Cross-Origin-Embedder-Policy", cfg.CrossOriginEmbedderPolicy},
+	} {
+		if header[1] != "" {
+			h.static = append(h.static, header)
+		}
+	}
+
+	return h
+}
+
+// isLocalHost reports whether host, with an optional port, is localhost or a
+// loopback address.
+func isLocalHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	addr, err := netip.ParseAddr(strings.Trim(host, "[]"))
+	return err == nil && addr.Unmap().IsLoopback()
+}
+
+// serverHeader expands {name} and {version} in the configured Server header.
+func serverHeader(format, name, version string) string {
+	return strings.NewReplacer("{name}", name, "{version}", version).Replace(format)
+}
+
+func (h *securityHeaders) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		if h.server != "" {
+			header.Set("Server", h.server)
+		}
+
+		if !h.enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		for _, static := range h.static {
+			header.Set(static[0], static[1])
+		}
+
+		// browsers ignore HSTS over plain HTTP, the scheme comes from a trusted
+		// proxy when TLS is terminated in front of the server. Local hosts are
+		// left out, so a development run doesn't pin them to HTTPS.
+		if h.hsts != "" && (r.TLS != nil || r.URL.Scheme == "https") && !isLocalHost(r.Host) {
+			header.Set("Strict-Transport-Security", h.hsts)
+		}
+
+		if h.csp != "" {
+			policy := h.csp
+			if strings.Contains(policy, "{nonce}") {
+				nonce := rand.Text()
+				policy = strings.ReplaceAll(policy, "{nonce}", nonce)
+				r = r.WithContext(context.WithValue(r.Context(), cspNonceKey{}, nonce))
+			}
+			header.Set(h.cspName, policy)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,117 @@
+package http
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	h := newSecurityHeaders(securityHeadersConfig{
+		Enabled:               true,
+		HSTSMaxAge:            24 * time.Hour,
+		HSTSIncludeSubdomains: true,
+		ContentSecurityPolicy: "script-src 'nonce-{nonce}'",
+		ContentTypeOptions:    "nosniff",
+		ReferrerPolicy:        "no-referrer",
+	}, serverHeader("{name}/{version}", "test", "1.0.0"))
+
+	var nonce string
+	handler := h.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce = CSPNonceFromContext(r.Context())
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.TLS = &tls.ConnectionState{}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	for header, want := range map[string]string{
+		"Server":                    "test/1.0.0",
+		"Strict-Transport-Security": "max-age=86400; includeSubDomains",
+		"X-Content-Type-Options":    "nosniff",
+		"Referrer-Policy":           "no-referrer",
+		"X-Frame-Options":           "",
+		"Content-Security-Policy":   "script-src 'nonce-" + nonce + "'",
+	} {
+		if got := w.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+	if nonce == "" {
+		t.Fatal("no nonce in the request context")
+	}
+
+	// every request gets a fresh nonce
+	first := nonce
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if nonce == first {
+		t.Error("nonce was reused")
+	}
+}
+
+func TestSecurityHeadersPlainHTTP(t *testing.T) {
+	h := newSecurityHeaders(securityHeadersConfig{Enabled: true, HSTSMaxAge: time.Hour, CSPReportOnly: true, ContentSecurityPolicy: "default-src 'self'"}, "")
+	handler := h.handler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+
+	if got := w.Header().Get("Strict-Transport-Security"); got != "" {
+		t.Errorf("Strict-Transport-Security over HTTP = %q", got)
+	}
+	if got := w.Header().Get("Content-Security-Policy-Report-Only"); got != "default-src 'self'" {
+		t.Errorf("Content-Security-Policy-Report-Only = %q", got)
+	}
+	if _, ok := w.Header()["Server"]; ok {
+		t.Error("empty Server header was sent")
+	}
+
+	// a trusted proxy that terminated TLS sets the scheme
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.URL.Scheme = "https"
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if got := w.Header().Get("Strict-Transport-Security"); got != "max-age=3600" {
+		t.Errorf("Strict-Transport-Security behind a TLS proxy = %q", got)
+	}
+}
+
+func TestSecurityHeadersLocalHost(t *testing.T) {
+	h := newSecurityHeaders(securityHeadersConfig{Enabled: true, HSTSMaxAge: time.Hour}, "")
+	handler := h.handler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	for host, want := range map[string]string{
+		"localhost:8443":     "",
+		"app.localhost":      "",
+		"127.0.0.1:8443":     "",
+		"[::1]:8443":         "",
+		"example.com":        "max-age=3600",
+		"192.0.2.1:8443":     "max-age=3600",
+		"localhost.evil.net": "max-age=3600",
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Host = host
+		r.TLS = &tls.ConnectionState{}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if got := w.Header().Get("Strict-Transport-Security"); got != want {
+			t.Errorf("Strict-Transport-Security for %s = %q, want %q", host, got, want)
+		}
+	}
+}
+
+func TestSecurityHeadersDisabled(t *testing.T) {
+	h := newSecurityHeaders(securityHeadersConfig{ContentTypeOptions: "nosniff"}, "test")
+	w := httptest.NewRecorder()
+	h.handler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if got := w.Header().Get("X-Content-Type-Options"); got != "" {
+		t.Errorf("disabled X-Content-Type-Options = %q", got)
+	}
+	if got := w.Header().Get("Server"); got != "test" {
+		t.Errorf("Server = %q, want test", got)
+	}
+}
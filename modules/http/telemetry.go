@@ -2,6 +2,7 @@ package http
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/gorilla/mux"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
@@ -12,6 +13,7 @@ import (
 type telemetry struct {
 	staticRoute    *mux.Route
 	allowedMethods []string
+	modules        map[*mux.Route]string
 }
 
 var cloudflareHeaders = map[string]attribute.Key{
@@ -33,6 +35,7 @@ func (t *telemetry) handler(next http.Handler) http.Handler {
 				span.SetAttributes(key.StringSlice(values))
 			}
 		}
+		setClientIdentitySpan(r)
 
 		next.ServeHTTP(w, r)
 	})
@@ -79,14 +82,22 @@ func (t *telemetry) configureFallbackHandlers(router *mux.Router) error {
 		})
 	}
 	router.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		t.enrichRoute(r, t.methodNotAllowedRoute(router, r))
+		route, allowed := t.methodNotAllowedRoute(router, r)
+		t.enrichRoute(r, route)
+		if len(allowed) > 0 {
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+		}
 		methodNotAllowedHandler.ServeHTTP(w, r)
 	})
 
 	return nil
 }
 
-func (t *telemetry) methodNotAllowedRoute(router *mux.Router, r *http.Request) *mux.Route {
+// methodNotAllowedRoute returns the route r matches with another registered
+// method, and every registered method the request's path allows.
+func (t *telemetry) methodNotAllowedRoute(router *mux.Router, r *http.Request) (*mux.Route, []string) {
+	var route *mux.Route
+	var allowed []string
 	for _, method := range t.allowedMethods {
 		if method == r.Method {
 			continue
@@ -98,10 +109,13 @@ func (t *telemetry) methodNotAllowedRoute(router *mux.Router, r *http.Request) *
 		probe.Method = method
 		var match mux.RouteMatch
 		if router.Match(probe, &match) && match.MatchErr == nil && match.Route != nil {
-			return match.Route
+			if route == nil {
+				route = match.Route
+			}
+			allowed = append(allowed, method)
 		}
 	}
-	return nil
+	return route, allowed
 }
 
 func (t *telemetry) enrichRoute(r *http.Request, route *mux.Route) {
@@ -119,11 +133,16 @@ func (t *telemetry) enrichRoute(r *http.Request, route *mux.Route) {
 		return
 	}
 
+	attrs := []attribute.KeyValue{attribute.String("http.route", routeName)}
+	if module := t.modules[route]; module != "" {
+		attrs = append(attrs, attribute.String("http.route.module", module))
+	}
+
 	span := trace.SpanFromContext(r.Context())
 	span.SetName(r.Method + " " + routeName)
-	span.SetAttributes(attribute.String("http.route", routeName))
+	span.SetAttributes(attrs...)
 
 	if labeler, ok := otelhttp.LabelerFromContext(r.Context()); ok {
-		labeler.Add(attribute.String("http.route", routeName))
+		labeler.Add(attrs...)
 	}
 }
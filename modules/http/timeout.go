@@ -0,0 +1,136 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type routeTimeoutConfig struct {
+	Route        string        `setting:"route" description:"The route template the timeouts apply to, such as /events"`
+	Timeout      time.Duration `setting:"timeout" description:"The maximum duration the route's handler has to respond, zero keeps the route's own or the server request_timeout and a negative duration removes it"`
+	WriteTimeout time.Duration `setting:"write_timeout" description:"The maximum duration for writing the route's response, zero keeps the server write_timeout and a negative duration removes it"`
+}
+
+// errRequestTimeout is the cause of request contexts canceled by their route
+// timeout, telling them apart from deadlines set by clients or handlers.
+var errRequestTimeout = errors.New("http: request timeout")
+
+// timeouts sets the request context deadline from the route's timeout, or
+// the server wide timeout for routes without one, and the route's write
+// deadline.
+type timeouts struct {
+	timeout  time.Duration
+	routes   map[string]routeTimeoutConfig
+	timedOut metric.Int64Counter
+}
+
+func newTimeouts(meter metric.Meter, timeout time.Duration, routes []routeTimeoutConfig) (*timeouts, error) {
+	t := &timeouts{timeout: timeout, routes: make(map[string]routeTimeoutConfig, len(routes))}
+	for _, route := range routes {
+		if route.Route == "" {
+			return nil, errors.New("route timeout needs a route")
+		}
+		if _, exists := t.routes[route.Route]; exists {
+			return nil, fmt.Errorf("route %q is configured more than once", route.Route)
+		}
+		t.routes[route.Route] = route
+	}
+
+	var err error
+	t.timedOut, err = meter.Int64Counter(
+		"http.server.request.timeouts",
+		metric.WithUnit("{request}"),
+		metric.WithDescription("Number of requests that exceeded their route timeout"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request timeout counter: %w", err)
+	}
+
+	return t, nil
+}
+
+// middleware applies the timeouts once mux has matched a route. Handlers
+// observe the deadline through the request context, and the ones that give
+// up without responding get a 503 problem details response.
+func (t *timeouts) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var template string
+		route := routeTimeoutConfig{Timeout: t.timeout}
+		if current := mux.CurrentRoute(r); current != nil {
+			template, _ = current.GetPathTemplate()
+			if h, ok := routeHandler[*timeoutHandler](current); ok {
+				route.Timeout = h.timeout
+			}
+		}
+		// settings left at zero keep the timeouts the route would have
+		// without the block
+		if configured, ok := t.routes[template]; ok {
+			if configured.Timeout != 0 {
+				route.Timeout = configured.Timeout
+			}
+			route.WriteTimeout = configured.WriteTimeout
+		}
+
+		if route.WriteTimeout != 0 {
+			var deadline time.Time
+			if route.WriteTimeout > 0 {
+				deadline = time.Now().Add(route.WriteTimeout)
+			}
+			// recorders and other writers without a connection don't support it
+			_ = http.NewResponseController(w).SetWriteDeadline(deadline)
+		}
+
+		if route.Timeout <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeoutCause(r.Context(), route.Timeout, errRequestTimeout)
+		defer cancel()
+
+		var written bool
+		next.ServeHTTP(trackWritten(w, &written), r.WithContext(ctx))
+
+		if context.Cause(ctx) != errRequestTimeout {
+			return
+		}
+
+		// the handler may take a while to notice, the event is when it happened
+		deadline, _ := ctx.Deadline()
+		trace.SpanFromContext(ctx).AddEvent("http.server.request.timeout",
+			trace.WithTimestamp(deadline),
+			trace.WithAttributes(attribute.String("http.request.timeout", route.Timeout.String())),
+		)
+		t.timedOut.Add(ctx, 1, metric.WithAttributes(attribute.String("http.route", template)))
+
+		if !written {
+			WriteProblem(w, NewProblem(http.StatusServiceUnavailable, fmt.Sprintf("request did not complete within %s", route.Timeout)))
+		}
+	})
+}
+
+// Timeout sets the timeout of the route handled by next, such as a route
+// calling a slow dependency. A timeout of zero or less removes it, for
+// routes streaming responses such as server-sent events. It must be the
+// route's handler, or wrapped by other route handlers such as Document, and
+// a route_timeout setting for the route takes precedence.
+func Timeout(timeout time.Duration, next http.Handler) http.Handler {
+	return &timeoutHandler{timeout: timeout, Handler: next}
+}
+
+type timeoutHandler struct {
+	http.Handler
+	timeout time.Duration
+}
+
+func (h *timeoutHandler) Unwrap() http.Handler {
+	return h.Handler
+}
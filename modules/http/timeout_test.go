@@ -0,0 +1,156 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+func TestTimeouts(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	t.Cleanup(func() { _ = provider.Shutdown(t.Context()) })
+
+	timeouts, err := newTimeouts(provider.Meter("test"), 20*time.Millisecond, []routeTimeoutConfig{
+		{Route: "/configured", Timeout: time.Hour},
+		{Route: "/write", WriteTimeout: time.Minute},
+		{Route: "/unlimited", Timeout: -1},
+	})
+	if err != nil {
+		t.Fatalf("new timeouts: %v", err)
+	}
+
+	deadline := func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Deadline(); ok {
+			_, _ = io.WriteString(w, "deadline")
+			return
+		}
+		_, _ = io.WriteString(w, "none")
+	}
+	handler, recorder, _ := newTelemetryTestHandler(t, func(router *mux.Router, _ *telemetry) {
+		router.Use(timeouts.middleware)
+		router.HandleFunc("/slow/{id}", func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		})
+		router.Handle("/dependency", Handle(Operation{}, func(ctx context.Context, _ struct{}) (struct{}, error) {
+			<-ctx.Done()
+			return struct{}{}, ctx.Err()
+		}))
+		router.HandleFunc("/default", deadline)
+		router.HandleFunc("/write", deadline)
+		router.HandleFunc("/unlimited", deadline)
+		router.Handle("/streaming", Document(Operation{}, Timeout(0, http.HandlerFunc(deadline))))
+		router.Handle("/configured", Timeout(0, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			d, _ := r.Context().Deadline()
+			if time.Until(d) < time.Minute {
+				t.Errorf("deadline = %s, want the configured hour", d)
+			}
+		})))
+	})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow/1", nil))
+
+	var problem Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil || w.Code != http.StatusServiceUnavailable || problem.Detail != "request did not complete within 20ms" {
+		t.Errorf("response = %d %+v, %v", w.Code, problem, err)
+	}
+
+	events := onlyEndedSpan(t, recorder).Events()
+	if len(events) != 1 || events[0].Name != "http.server.request.timeout" {
+		t.Errorf("span events = %+v", events)
+	}
+	if count := int64Sum(t, reader, "http.server.request.timeouts", "http.route", "/slow/{id}"); count != 1 {
+		t.Errorf("timeouts = %d, want 1", count)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/dependency", nil))
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("dependency status = %d, want %d", w.Code, http.StatusGatewayTimeout)
+	}
+
+	for path, want := range map[string]string{"/default": "deadline", "/streaming": "none", "/write": "deadline", "/unlimited": "none"} {
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Body.String() != want {
+			t.Errorf("%s = %q, want %q", path, w.Body.String(), want)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/configured", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("configured status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	if count := int64Sum(t, reader, "http.server.request.timeouts", "http.route", "/slow/{id}"); count != 1 {
+		t.Errorf("timeouts = %d, want 1", count)
+	}
+}
+
+func TestTimeoutsWriteDeadline(t *testing.T) {
+	timeouts, err := newTimeouts(sdkmetric.NewMeterProvider().Meter("test"), 0, []routeTimeoutConfig{
+		{Route: "/events", WriteTimeout: -1},
+	})
+	if err != nil {
+		t.Fatalf("new timeouts: %v", err)
+	}
+
+	handler, _, _ := newTelemetryTestHandler(t, func(router *mux.Router, _ *telemetry) {
+		router.Use(timeouts.middleware)
+		router.HandleFunc("/events", func(w http.ResponseWriter, _ *http.Request) {
+			time.Sleep(100 * time.Millisecond)
+			_, _ = io.WriteString(w, "event")
+		})
+		router.HandleFunc("/extended", func(w http.ResponseWriter, _ *http.Request) {
+			// handlers extend their own deadline through the wrapped writers
+			if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(time.Second)); err != nil {
+				t.Errorf("set write deadline: %v", err)
+			}
+			time.Sleep(100 * time.Millisecond)
+			_, _ = io.WriteString(w, "event")
+		})
+		router.HandleFunc("/slow", func(w http.ResponseWriter, _ *http.Request) {
+			time.Sleep(100 * time.Millisecond)
+			_, _ = io.WriteString(w, "event")
+		})
+	})
+
+	server := httptest.NewUnstartedServer(handler)
+	server.Config.WriteTimeout = 20 * time.Millisecond
+	server.Start()
+	t.Cleanup(server.Close)
+
+	for path, ok := range map[string]bool{"/events": true, "/extended": true, "/slow": false} {
+		response, err := server.Client().Get(server.URL + path)
+		if err != nil {
+			if ok {
+				t.Errorf("%s: %v", path, err)
+			}
+			continue
+		}
+		body, err := io.ReadAll(response.Body)
+		_ = response.Body.Close()
+		if got := err == nil && string(body) == "event"; got != ok {
+			t.Errorf("%s = %q, %v, want success %t", path, body, err, ok)
+		}
+	}
+}
+
+func TestNewTimeoutsInvalid(t *testing.T) {
+	meter := sdkmetric.NewMeterProvider().Meter("test")
+	if _, err := newTimeouts(meter, 0, []routeTimeoutConfig{{Timeout: time.Second}}); err == nil {
+		t.Error("route timeout without a route succeeded")
+	}
+	if _, err := newTimeouts(meter, 0, []routeTimeoutConfig{{Route: "/a"}, {Route: "/a"}}); err == nil {
+		t.Error("duplicate route timeout succeeded")
+	}
+}
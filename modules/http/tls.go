@@ -0,0 +1,221 @@
+package http
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/renevo/application"
+	"golang.org/x/crypto/acme"
+)
+
+type tlsConfig struct {
+	MinVersion       string                 `setting:"min_version" description:"The minimum TLS version to accept: 1.0, 1.1, 1.2 or 1.3"`
+	MaxVersion       string                 `setting:"max_version" description:"The maximum TLS version to accept, empty for the newest supported version"`
+	CipherSuites     []string               `setting:"cipher_suites" description:"The TLS 1.0-1.2 cipher suites to accept by name, empty for Go's defaults"`
+	CurvePreferences []string               `setting:"curve_preferences" description:"The key exchange mechanisms to accept in preference order, such as X25519 or P256"`
+	ALPN             []string               `setting:"alpn" description:"The application protocols to negotiate in preference order, empty for h2 and http/1.1"`
+	Certificates     []tlsCertificateConfig `config:"certificate,block"`
+}
+
+// tlsCertificateConfig is an additional certificate pair, served to clients
+// whose SNI host name it covers.
+type tlsCertificateConfig struct {
+	CertificateFile string `setting:"cert_file" description:"File location for the certificate file"`
+	KeyFile         string `setting:"key_file" description:"File location for the certificate key file"`
+}
+
+// configureTLS sets the server TLS configuration from the module settings. It
+// returns false when TLS is disabled.
+func (m *module) configureTLS(ctx *application.Context) (bool, error) {
+	staticFiles := m.cfg.HTTP.CertificateFile != "" && m.cfg.HTTP.KeyFile != ""
+	sniFiles := len(m.cfg.HTTP.TLS.Certificates) > 0
+	if (staticFiles || sniFiles) && len(m.cfg.HTTP.ACME.Domains) > 0 {
+		return false, errors.New("http.acme cannot be combined with certificate files")
+	}
+	if m.cfg.HTTP.DevTLS.Enabled && (staticFiles || sniFiles || len(m.cfg.HTTP.ACME.Domains) > 0) {
+		return false, errors.New("http.dev_tls cannot be combined with certificate files or http.acme")
+	}
+
+	switch {
+	case len(m.cfg.HTTP.ACME.Domains) > 0:
+		cache, err := acmeCache(ctx, m.cfg.HTTP.ACME)
+		if err != nil {
+			return false, err
+		}
+		if cache == nil {
+			ctx.Logger().Warn("ACME certificates are not cached and will be requested on every start, set http.acme.cache_dir or http.acme.nats_bucket")
+		}
+
+		manager, err := newACMEManager(m.cfg.HTTP.ACME, cache)
+		if err != nil {
+			return false, err
+		}
+		m.acme = manager
+		m.server.TLSConfig = manager.TLSConfig()
+
+	case staticFiles || sniFiles || m.cfg.HTTP.DevTLS.Enabled:
+		// the top level pair is the default when no SNI certificate matches
+		files := slices.Clone(m.cfg.HTTP.TLS.Certificates)
+		if staticFiles {
+			files = slices.Insert(files, 0, tlsCertificateConfig{CertificateFile: m.cfg.HTTP.CertificateFile, KeyFile: m.cfg.HTTP.KeyFile})
+		}
+
+		if m.cfg.HTTP.DevTLS.Enabled {
+			dir := m.cfg.HTTP.DevTLS.CacheDir
+			if dir == "" {
+				cacheDir, err := os.UserCacheDir()
+				if err != nil {
+					return false, fmt.Errorf("failed to locate development certificate cache, set http.dev_tls.cache_dir: %w", err)
+				}
+				dir = filepath.Join(cacheDir, ctx.Application().Name(), "dev-tls")
+			}
+
+			dev, err := ensureDevCertificate(dir, ctx.Application().Name(), m.cfg.HTTP.DevTLS.Hosts)
+			if err != nil {
+				return false, err
+			}
+			ctx.Logger().Warn("Serving a development TLS certificate, trust its CA to avoid certificate errors", "ca_file", dev.CAFile)
+
+			files = append(files, tlsCertificateConfig{CertificateFile: dev.CertFile, KeyFile: dev.KeyFile})
+		}
+
+		for _, file := range files {
+			certs, err := newCertReloader(file.CertificateFile, file.KeyFile, ctx.Logger())
+			if err != nil {
+				m.certs.close()
+				m.certs = nil
+				return false, err
+			}
+			m.certs = append(m.certs, certs)
+		}
+		if m.cfg.HTTP.CertificateReloadInterval > 0 {
+			m.certs.watch(m.cfg.HTTP.CertificateReloadInterval)
+		}
+		m.server.TLSConfig = &tls.Config{GetCertificate: m.certs.GetCertificate}
+
+	default:
+		if mode := strings.ToLower(m.cfg.HTTP.ClientAuth); mode != "" && mode != "none" {
+			return false, fmt.Errorf("http.client_auth %q requires TLS", m.cfg.HTTP.ClientAuth)
+		}
+		return false, nil
+	}
+
+	if err := applyTLSConfig(m.server, m.cfg.HTTP.TLS); err != nil {
+		return false, err
+	}
+
+	if err := configureClientAuth(m.server.TLSConfig, m.cfg.HTTP); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// applyTLSConfig applies the protocol settings in cfg to the server's TLS
+// configuration.
+func applyTLSConfig(server *http.Server, cfg tlsConfig) error {
+	config := server.TLSConfig
+
+	var err error
+	if config.MinVersion, err = parseTLSVersion(cfg.MinVersion); err != nil {
+		return fmt.Errorf("invalid http.tls.min_version: %w", err)
+	}
+	if config.MaxVersion, err = parseTLSVersion(cfg.MaxVersion); err != nil {
+		return fmt.Errorf("invalid http.tls.max_version: %w", err)
+	}
+	if config.MinVersion != 0 && config.MaxVersion != 0 && config.MinVersion > config.MaxVersion {
+		return fmt.Errorf("http.tls.min_version %s is newer than max_version %s", cfg.MinVersion, cfg.MaxVersion)
+	}
+
+	if config.CipherSuites, err = parseCipherSuites(cfg.CipherSuites); err != nil {
+		return fmt.Errorf("invalid http.tls.cipher_suites: %w", err)
+	}
+	if config.CurvePreferences, err = parseCurves(cfg.CurvePreferences); err != nil {
+		return fmt.Errorf("invalid http.tls.curve_preferences: %w", err)
+	}
+
+	if len(cfg.ALPN) > 0 {
+		protos := slices.Clone(cfg.ALPN)
+
+		// keep answering ACME TLS-ALPN-01 challenges
+		if slices.Contains(config.NextProtos, acme.ALPNProto) && !slices.Contains(protos, acme.ALPNProto) {
+			protos = append(protos, acme.ALPNProto)
+		}
+		config.NextProtos = protos
+
+		// the server adds h2 unless HTTP/2 is disabled with a non-nil map
+		if !slices.Contains(protos, "h2") {
+			server.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+		}
+	}
+
+	return nil
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func parseTLSVersion(version string) (uint16, error) {
+	if version == "" {
+		return 0, nil
+	}
+
+	v, ok := tlsVersions[strings.TrimPrefix(strings.ToLower(version), "tls")]
+	if !ok {
+		return 0, fmt.Errorf("unknown TLS version %q, expected 1.0, 1.1, 1.2 or 1.3", version)
+	}
+	return v, nil
+}
+
+// parseCipherSuites resolves cipher suite names. Suites Go considers insecure
+// are rejected.
+func parseCipherSuites(names []string) ([]uint16, error) {
+	var ids []uint16
+	for _, name := range names {
+		matches := func(suite *tls.CipherSuite) bool {
+			return strings.EqualFold(suite.Name, name)
+		}
+
+		idx := slices.IndexFunc(tls.CipherSuites(), matches)
+		if idx < 0 {
+			if slices.ContainsFunc(tls.InsecureCipherSuites(), matches) {
+				return nil, fmt.Errorf("cipher suite %q is insecure", name)
+			}
+			return nil, fmt.Errorf("unknown cipher suite %q", name)
+		}
+		ids = append(ids, tls.CipherSuites()[idx].ID)
+	}
+	return ids, nil
+}
+
+var tlsCurves = map[string]tls.CurveID{
+	"x25519":         tls.X25519,
+	"x25519mlkem768": tls.X25519MLKEM768,
+	"p256":           tls.CurveP256,
+	"p384":           tls.CurveP384,
+	"p521":           tls.CurveP521,
+}
+
+// parseCurves resolves curve names such as X25519, P256, P-256 or CurveP256.
+func parseCurves(names []string) ([]tls.CurveID, error) {
+	var ids []tls.CurveID
+	for _, name := range names {
+		key := strings.TrimPrefix(strings.ReplaceAll(strings.ToLower(name), "-", ""), "curve")
+		id, ok := tlsCurves[key]
+		if !ok {
+			return nil, fmt.Errorf("unknown curve %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
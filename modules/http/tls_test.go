@@ -0,0 +1,105 @@
+package http
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+func TestApplyTLSConfig(t *testing.T) {
+	server := &http.Server{TLSConfig: &tls.Config{}}
+	err := applyTLSConfig(server, tlsConfig{
+		MinVersion:       "1.2",
+		MaxVersion:       "TLS1.3",
+		CipherSuites:     []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", "tls_ecdhe_rsa_with_aes_256_gcm_sha384"},
+		CurvePreferences: []string{"X25519", "P-256", "CurveP384"},
+	})
+	if err != nil {
+		t.Fatalf("apply TLS config: %v", err)
+	}
+
+	config := server.TLSConfig
+	if config.MinVersion != tls.VersionTLS12 || config.MaxVersion != tls.VersionTLS13 {
+		t.Errorf("versions = %x-%x, want %x-%x", config.MinVersion, config.MaxVersion, tls.VersionTLS12, tls.VersionTLS13)
+	}
+	if want := []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384}; !slices.Equal(config.CipherSuites, want) {
+		t.Errorf("cipher suites = %v, want %v", config.CipherSuites, want)
+	}
+	if want := []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384}; !slices.Equal(config.CurvePreferences, want) {
+		t.Errorf("curves = %v, want %v", config.CurvePreferences, want)
+	}
+	if server.TLSNextProto != nil {
+		t.Error("HTTP/2 disabled without ALPN settings")
+	}
+}
+
+func TestApplyTLSConfigInvalid(t *testing.T) {
+	for name, cfg := range map[string]tlsConfig{
+		"version":        {MinVersion: "1.4"},
+		"version range":  {MinVersion: "1.3", MaxVersion: "1.2"},
+		"unknown suite":  {CipherSuites: []string{"TLS_BOGUS"}},
+		"insecure suite": {CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}},
+		"unknown curve":  {CurvePreferences: []string{"P-192"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if err := applyTLSConfig(&http.Server{TLSConfig: &tls.Config{}}, cfg); err == nil {
+				t.Error("invalid settings accepted")
+			}
+		})
+	}
+}
+
+func TestApplyTLSConfigALPN(t *testing.T) {
+	server := &http.Server{TLSConfig: &tls.Config{NextProtos: []string{acme.ALPNProto}}}
+	if err := applyTLSConfig(server, tlsConfig{ALPN: []string{"http/1.1"}}); err != nil {
+		t.Fatalf("apply TLS config: %v", err)
+	}
+
+	if want := []string{"http/1.1", acme.ALPNProto}; !slices.Equal(server.TLSConfig.NextProtos, want) {
+		t.Errorf("next protocols = %v, want %v", server.TLSConfig.NextProtos, want)
+	}
+	if server.TLSNextProto == nil {
+		t.Error("HTTP/2 not disabled when h2 is not negotiated")
+	}
+}
+
+func TestCertificatesSNI(t *testing.T) {
+	dir := t.TempDir()
+
+	var certs certificates
+	t.Cleanup(func() { certs.close() })
+	for _, name := range []string{"default.example.com", "api.example.com"} {
+		certFile, keyFile := filepath.Join(dir, name+".pem"), filepath.Join(dir, name+"-key.pem")
+		writeTestCertificate(t, certFile, keyFile, name, time.Now().Add(time.Hour))
+
+		reloader, err := newCertReloader(certFile, keyFile, slog.Default())
+		if err != nil {
+			t.Fatalf("new certificate reloader: %v", err)
+		}
+		certs = append(certs, reloader)
+	}
+
+	for serverName, want := range map[string]string{
+		"api.example.com":     "api.example.com",
+		"default.example.com": "default.example.com",
+		"other.example.com":   "default.example.com",
+	} {
+		cert, err := certs.GetCertificate(&tls.ClientHelloInfo{
+			ServerName:        serverName,
+			SupportedVersions: []uint16{tls.VersionTLS13},
+			SignatureSchemes:  []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256},
+		})
+		if err != nil {
+			t.Fatalf("get certificate for %s: %v", serverName, err)
+		}
+		if cert.Leaf.Subject.CommonName != want {
+			t.Errorf("certificate for %s = %s, want %s", serverName, cert.Leaf.Subject.CommonName, want)
+		}
+	}
+}
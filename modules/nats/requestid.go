@@ -0,0 +1,50 @@
+package nats
+
+import (
+	"context"
+
+	"github.com/nats-io/nats.go"
+	"github.com/renevo/bootstrap/internal/requestid"
+)
+
+// SetRequestID copies the ID of the HTTP request that ctx belongs to into the
+// X-Request-ID header of msg, unless msg already has one.
+func SetRequestID(ctx context.Context, msg *nats.Msg) {
+	id := requestid.FromContext(ctx)
+	if id == "" || msg.Header.Get(requestid.Header) != "" {
+		return
+	}
+	if msg.Header == nil {
+		msg.Header = nats.Header{}
+	}
+	msg.Header.Set(requestid.Header, id)
+}
+
+// PublishMsg publishes msg on nc with the request ID carried by ctx.
+func PublishMsg(ctx context.Context, nc *nats.Conn, msg *nats.Msg) error {
+	SetRequestID(ctx, msg)
+	return nc.PublishMsg(msg)
+}
+
+// Publish publishes data to subject on nc with the request ID carried by ctx.
+func Publish(ctx context.Context, nc *nats.Conn, subject string, data []byte) error {
+	return PublishMsg(ctx, nc, &nats.Msg{Subject: subject, Data: data})
+}
+
+// RequestMsg sends msg on nc with the request ID carried by ctx and waits for
+// a reply until ctx is done.
+func RequestMsg(ctx context.Context, nc *nats.Conn, msg *nats.Msg) (*nats.Msg, error) {
+	SetRequestID(ctx, msg)
+	return nc.RequestMsgWithContext(ctx, msg)
+}
+
+// ContextWithRequestID returns a copy of ctx carrying the request ID in the
+// headers of msg, so logs and messages published while handling a received
+// message keep the ID of the request that caused it.
+func ContextWithRequestID(ctx context.Context, msg *nats.Msg) context.Context {
+	id := msg.Header.Get(requestid.Header)
+	if !requestid.Valid(id) {
+		return ctx
+	}
+	return requestid.WithContext(ctx, id)
+}